@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/game"
+)
+
+const bindingCookieName = "wordcraft_binding"
+
+// bindingSecret signs the cookie which binds a player's seat to their browser, from TOKEN_BINDING_SECRET.
+// When empty, reconnect tokens aren't bound and anyone holding a valid token may reconnect with it
+var bindingSecret = []byte(getEnv("TOKEN_BINDING_SECRET", ""))
+
+func bindingEnabled() bool {
+	return len(bindingSecret) > 0
+}
+
+func signBinding(nonce string) string {
+	mac := hmac.New(sha256.New, bindingSecret)
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ensureBindingCookie gives the browser a signed binding cookie if it doesn't already have a valid one
+func ensureBindingCookie(c *gin.Context) {
+	if !bindingEnabled() || getBinding(c) != "" {
+		return
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	value := hex.EncodeToString(nonce)
+	value += "." + signBinding(value)
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(bindingCookieName, value, 0, "/", "", isProd, true)
+}
+
+// getBinding returns the verified binding from the request's cookie, or "" if it's missing or the signature doesn't match
+func getBinding(c *gin.Context) string {
+	if !bindingEnabled() {
+		return ""
+	}
+
+	value, err := c.Cookie(bindingCookieName)
+	if err != nil {
+		return ""
+	}
+
+	nonce, signature, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signBinding(nonce))) {
+		return ""
+	}
+
+	return nonce
+}
+
+// joinRequest builds the game.JoinRequest for the player making this request
+func joinRequest(c *gin.Context, reconnectToken string) game.JoinRequest {
+	return game.JoinRequest{ReconnectToken: reconnectToken, Binding: getBinding(c), IP: c.ClientIP(), AccessToken: c.Query("access"), Spectate: c.Query("spectate") == "true"}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/game"
+)
+
+// getOpenLobbies returns the public lobbies which are waiting for players and have room for more, fullest first
+func getOpenLobbies() []game.LobbySummary {
+	var open []game.LobbySummary
+	for item := range lobbies.IterBuffered() {
+		summary := item.Val.Summary()
+		if summary.Public && !summary.Private && summary.Status == game.WaitingForPlayers && summary.Players < summary.MaxPlayers {
+			open = append(open, summary)
+		}
+	}
+
+	slices.SortFunc(open, func(a, b game.LobbySummary) int {
+		return cmp.Or(b.Players-a.Players, cmp.Compare(a.Id, b.Id))
+	})
+	return open
+}
+
+// lists the public lobbies which can be joined right now. Each instance only lists the lobbies it owns
+func listLobbies(c *gin.Context) {
+	listed := make([]gin.H, 0)
+	if !draining.Load() {
+		for _, summary := range getOpenLobbies() {
+			listed = append(listed, gin.H{
+				"lobbyId":     summary.Id,
+				"players":     summary.Players,
+				"maxPlayers":  summary.MaxPlayers,
+				"mode":        summary.Mode,
+				"rounds":      summary.Rounds,
+				"targetScore": summary.TargetScore,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lobbies": listed})
+}
+
+// finds the fullest open public lobby for the player, or creates a new public lobby if there aren't any
+func quickPlay(c *gin.Context) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Server is restarting. Please try again shortly."})
+		return
+	}
+
+	if open := getOpenLobbies(); len(open) > 0 {
+		c.JSON(http.StatusOK, gin.H{"lobbyId": open[0].Id})
+		return
+	}
+
+	lobbyId, err := generateNewId(false)
+	if err != nil {
+		logger.Printf("Failed to claim a new lobby id: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to find a lobby."})
+		return
+	}
+
+	lobby := game.NewLobby(lobbyId, lobbyEndChan)
+	lobby.SetPublic(true)
+	startLobby(lobby)
+	c.JSON(http.StatusCreated, gin.H{"lobbyId": lobby.Id})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"compress/flate"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jhshelnu/wordcraft/game"
+)
+
+// getEnv reads the environment variable named key, falling back to def if it's unset
+func getEnv(key string, def string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+
+	return def
+}
+
+// getEnvInt reads an integer from the environment variable named key, falling back to def if it's unset or invalid
+func getEnvInt(key string, def int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Printf("WARN: %s=%q is not a valid integer. Falling back to %d.", key, value, def)
+		return def
+	}
+
+	return parsed
+}
+
+// getEnvBool reads a boolean from the environment variable named key, falling back to def if it's unset or invalid
+func getEnvBool(key string, def bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Printf("WARN: %s=%q is not a valid boolean. Falling back to %t.", key, value, def)
+		return def
+	}
+
+	return parsed
+}
+
+// trustedProxies are the addresses or CIDR ranges (from the comma separated TRUSTED_PROXIES) whose X-Forwarded-For headers
+// are believed when working out a client's IP. When empty, the IP is always the address of the peer connecting to the server
+var trustedProxies = getEnvList("TRUSTED_PROXIES")
+
+// getEnvList reads a comma separated list from the environment variable named key, or nil if it's unset or empty
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// wsConfig holds the tunables for websocket connections
+type wsConfig struct {
+	readBufferSize   int  // size of the per-connection read buffer, in bytes
+	writeBufferSize  int  // size of the write buffer, in bytes
+	compression      bool // whether to negotiate permessage-deflate with clients that support it
+	compressionLevel int  // the flate compression level used when compression is negotiated
+}
+
+func loadWsConfig() wsConfig {
+	config := wsConfig{
+		readBufferSize:   getEnvInt("WS_READ_BUFFER_SIZE", 1024),
+		writeBufferSize:  getEnvInt("WS_WRITE_BUFFER_SIZE", 1024),
+		compression:      getEnvBool("WS_COMPRESSION", true),
+		compressionLevel: getEnvInt("WS_COMPRESSION_LEVEL", flate.BestSpeed),
+	}
+
+	if config.compressionLevel < flate.HuffmanOnly || config.compressionLevel > flate.BestCompression {
+		logger.Printf("WARN: WS_COMPRESSION_LEVEL=%d is out of range. Falling back to %d.", config.compressionLevel, flate.BestSpeed)
+		config.compressionLevel = flate.BestSpeed
+	}
+
+	return config
+}
+
+// loadMessageRateLimits overrides the per message type rate limits with those in MESSAGE_RATE_LIMITS, a comma separated
+// list of type=perSecond/burst (e.g. "submit_answer=5/10,answer_preview=20/40"), and the limit shared by all other
+// types with MESSAGE_RATE_LIMIT_DEFAULT (e.g. "10/20"). Invalid entries are skipped with a warning
+func loadMessageRateLimits() {
+	if value, exists := os.LookupEnv("MESSAGE_RATE_LIMIT_DEFAULT"); exists {
+		if limit, err := parseRateLimit(value); err != nil {
+			logger.Printf("WARN: MESSAGE_RATE_LIMIT_DEFAULT=%q is not valid (%v). Ignoring it.", value, err)
+		} else {
+			game.DefaultMessageRateLimit = limit
+		}
+	}
+
+	for _, entry := range strings.Split(getEnv("MESSAGE_RATE_LIMITS", ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, _ := strings.Cut(entry, "=")
+		limit, err := parseRateLimit(value)
+		if err == nil {
+			err = game.SetMessageRateLimit(strings.TrimSpace(name), limit)
+		}
+		if err != nil {
+			logger.Printf("WARN: MESSAGE_RATE_LIMITS entry %q is not valid (%v). Ignoring it.", entry, err)
+		}
+	}
+}
+
+// parseRateLimit parses a rate limit written as perSecond/burst, e.g. "5/10" or "0.5/3"
+func parseRateLimit(value string) (game.RateLimit, error) {
+	perSecond, burst, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return game.RateLimit{}, errors.New("expected perSecond/burst")
+	}
+
+	var limit game.RateLimit
+	var err error
+	if limit.PerSecond, err = strconv.ParseFloat(perSecond, 64); err != nil || limit.PerSecond <= 0 {
+		return game.RateLimit{}, errors.New("perSecond must be a positive number")
+	}
+	if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst <= 0 {
+		return game.RateLimit{}, errors.New("burst must be a positive integer")
+	}
+	return limit, nil
+}
@@ -0,0 +1,208 @@
+package game
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MaxPassword    = 64 // the longest password a private lobby may have
+	MaxInviteCodes = 20 // the most invite codes a private lobby may be created with
+
+	accessTokenTimeout = 2 * time.Minute // how long an access token can be used to join, after the player's credential was checked
+)
+
+var (
+	ErrAccessDenied = errors.New("password or invite code is required to join this lobby")
+	ErrInviteUsed   = errors.New("invite code has already been used")
+)
+
+// lobbyAccess decides who may join a private lobby: anyone with the password, or anyone with an invite code that
+// hasn't been used yet. It's checked while joining, outside the lobby goroutine, so it has its own lock
+type lobbyAccess struct {
+	mut          sync.Mutex
+	passwordHash []byte                 // bcrypt hash of the lobby's password, or nil if it doesn't have one
+	inviteCodes  map[string]bool        // every invite code issued for the lobby, and whether it has been used
+	accessTokens map[string]accessGrant // short-lived tokens handed out by GrantAccess, which stand in for the credential when joining
+}
+
+// accessGrant is what an access token was issued for
+type accessGrant struct {
+	inviteCode string // the invite code the token was issued for, which is used up when they join, or "" for the password
+	expiresAt  time.Time
+}
+
+// AccessSnapshot is the serializable form of a lobbyAccess, used in snapshots
+type AccessSnapshot struct {
+	PasswordHash []byte
+	InviteCodes  map[string]bool
+}
+
+func newLobbyAccess() *lobbyAccess {
+	return &lobbyAccess{inviteCodes: make(map[string]bool), accessTokens: make(map[string]accessGrant)}
+}
+
+// SetPassword makes the lobby private, requiring the password (or an invite code) to join
+func (lobby *Lobby) SetPassword(password string) error {
+	if len(password) > MaxPassword {
+		return fmt.Errorf("password must be at most %d characters", MaxPassword)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	lobby.access.mut.Lock()
+	defer lobby.access.mut.Unlock()
+
+	lobby.access.passwordHash = hash
+	return nil
+}
+
+// CreateInviteCodes makes the lobby private, and returns count new invite codes which can each be used to join it once
+func (lobby *Lobby) CreateInviteCodes(count int) []string {
+	lobby.access.mut.Lock()
+	defer lobby.access.mut.Unlock()
+
+	codes := make([]string, 0, count)
+	for range count {
+		codeBytes := make([]byte, 8)
+		if _, err := rand.Read(codeBytes); err != nil {
+			panic(fmt.Sprintf("unable to generate invite code: %v", err))
+		}
+
+		code := hex.EncodeToString(codeBytes)
+		lobby.access.inviteCodes[code] = false
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// IsPrivate reports whether a password or invite code is needed to join the lobby
+func (lobby *Lobby) IsPrivate() bool {
+	lobby.access.mut.Lock()
+	defer lobby.access.mut.Unlock()
+
+	return lobby.access.isPrivate()
+}
+
+// GrantAccess checks the password or invite code of a player about to join the lobby, and returns a short-lived access
+// token for them to join with, so the credential itself doesn't need to be sent again (e.g. in a URL). An invite code is
+// only ever compared against the lobby's invite codes, never its password. Invite codes which have already been used are
+// still accepted here, so players who joined with one can reload the page. Whether the code is still unused is only
+// checked once they join. Public lobbies don't need a token, so "" is returned
+func (lobby *Lobby) GrantAccess(password string, inviteCode string) (string, error) {
+	lobby.access.mut.Lock()
+	defer lobby.access.mut.Unlock()
+
+	if !lobby.access.isPrivate() {
+		return "", nil
+	}
+
+	var grant accessGrant
+	if inviteCode != "" {
+		if _, isInviteCode := lobby.access.inviteCodes[inviteCode]; !isInviteCode {
+			return "", ErrAccessDenied
+		}
+		grant.inviteCode = inviteCode
+	} else if !lobby.access.checkPassword(password) {
+		return "", ErrAccessDenied
+	}
+
+	now := time.Now()
+	for token, existing := range lobby.access.accessTokens {
+		if now.After(existing.expiresAt) {
+			delete(lobby.access.accessTokens, token)
+		}
+	}
+
+	grant.expiresAt = now.Add(accessTokenTimeout)
+	token := generateAccessToken()
+	lobby.access.accessTokens[token] = grant
+	return token, nil
+}
+
+// admit checks the access token of a player joining the lobby as a new client, using up their invite code if that's what they had.
+// The token may be used more than once until it expires, e.g. if the websocket fails and the player falls back to an event stream
+func (access *lobbyAccess) admit(accessToken string) error {
+	access.mut.Lock()
+	defer access.mut.Unlock()
+
+	if !access.isPrivate() {
+		return nil
+	}
+
+	grant, exists := access.accessTokens[accessToken]
+	if !exists || time.Now().After(grant.expiresAt) {
+		return ErrAccessDenied
+	}
+
+	if grant.inviteCode != "" {
+		if access.inviteCodes[grant.inviteCode] {
+			return ErrInviteUsed
+		}
+		access.inviteCodes[grant.inviteCode] = true
+	}
+	return nil
+}
+
+// isPrivate must be called with mut held
+func (access *lobbyAccess) isPrivate() bool {
+	return access.passwordHash != nil || len(access.inviteCodes) > 0
+}
+
+// checkPassword must be called with mut held
+func (access *lobbyAccess) checkPassword(password string) bool {
+	return access.passwordHash != nil && password != "" && bcrypt.CompareHashAndPassword(access.passwordHash, []byte(password)) == nil
+}
+
+// export leaves out access tokens, since they expire long before a restored lobby would see them used
+func (access *lobbyAccess) export() AccessSnapshot {
+	access.mut.Lock()
+	defer access.mut.Unlock()
+
+	return AccessSnapshot{PasswordHash: access.passwordHash, InviteCodes: maps.Clone(access.inviteCodes)}
+}
+
+func (access *lobbyAccess) restore(snapshot AccessSnapshot) {
+	access.mut.Lock()
+	defer access.mut.Unlock()
+
+	access.passwordHash = snapshot.PasswordHash
+	for code, used := range snapshot.InviteCodes {
+		access.inviteCodes[code] = used
+	}
+}
+
+func generateAccessToken() string {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		panic(fmt.Sprintf("unable to generate access token: %v", err))
+	}
+
+	return hex.EncodeToString(tokenBytes)
+}
+
+// joinRejection returns what to tell a player whose join was rejected with err, or false if it wasn't a rejection they need to be told about
+func joinRejection(err error) (string, bool) {
+	switch {
+	case errors.Is(err, ErrBanned):
+		return bannedReason, true
+	case errors.Is(err, ErrAccessDenied):
+		return "This lobby is private", true
+	case errors.Is(err, ErrInviteUsed):
+		return "This invite has already been used", true
+	case errors.Is(err, ErrLobbyEnded):
+		return "This lobby has closed", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,61 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGrantAccess(t *testing.T) {
+	lobby := NewLobby("access-test", make(chan string, 1))
+	if err := lobby.SetPassword("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	inviteCode := lobby.CreateInviteCodes(1)[0]
+
+	tests := []struct {
+		name       string
+		password   string
+		inviteCode string
+		granted    bool
+	}{
+		{name: "password", password: "hunter2", granted: true},
+		{name: "wrong password", password: "hunter3", granted: false},
+		{name: "invite code", inviteCode: inviteCode, granted: true},
+		{name: "unknown invite code", inviteCode: "0123456789abcdef", granted: false},
+		{name: "password as invite code", inviteCode: "hunter2", granted: false},
+		{name: "invite code as password", password: inviteCode, granted: false},
+		{name: "nothing", granted: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := lobby.GrantAccess(test.password, test.inviteCode)
+			if test.granted && (err != nil || token == "") {
+				t.Errorf("GrantAccess() = %q, %v, want a token", token, err)
+			}
+			if !test.granted && !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("GrantAccess() = %q, %v, want %v", token, err, ErrAccessDenied)
+			}
+		})
+	}
+}
+
+func TestInviteAccessTokenIsSingleUse(t *testing.T) {
+	lobby := NewLobby("access-test", make(chan string, 1))
+	inviteCode := lobby.CreateInviteCodes(1)[0]
+
+	token, err := lobby.GrantAccess("", inviteCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lobby.access.admit(token); err != nil {
+		t.Fatalf("first join with the invite failed: %v", err)
+	}
+	if err := lobby.access.admit(token); !errors.Is(err, ErrInviteUsed) {
+		t.Errorf("second join with the invite = %v, want %v", err, ErrInviteUsed)
+	}
+	if err := lobby.access.admit("not-a-token"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("join without a valid token = %v, want %v", err, ErrAccessDenied)
+	}
+}
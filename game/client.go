@@ -2,71 +2,149 @@ package game
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-const reconnectionTimeout = 5 * time.Second
-
-var recoverableWsErrors = []int{websocket.CloseNormalClosure, websocket.CloseGoingAway}
+const (
+	reconnectionTimeout = 5 * time.Second
+	rttSampleCount      = 5 // how many recent round trip samples are averaged into a client's rtt
+	rttOutlierFactor    = 3 // samples are clamped to this many times the current average, so one slow (or faked) sample can't skew it
+)
 
 type Client struct {
-	id             int             // uniquely identifies the Client within the lobby
-	reconnectToken string          // a randomly generated token sent to the client to be used for reconnecting
-	displayName    string          // the display name for the client (shown to other players)
-	iconName       string          // the file name of the icon to show for this client in the lobby
-	lobby          *Lobby          // holds a reference to the lobby that the client is in
-	ws             *websocket.Conn // holds a reference to the WebSocket connection
-	wsMut          sync.Mutex      // used to synchronize clearing and re-establishing new websocket conns between client threads
-	write          chan Message    // a write channel used by the lobby to pass messages that the client should transmit over the websocket
-	disconnected   chan bool       // a channel used by the client's Read and Write goroutines to synchronize disconnects
-}
-
-// JoinConnToLobby registers this connection as belonging to a client in the lobby
-// either by creating a new client and connecting, or by re-establishing connection with an existing client (using the specified reconnectToken if not empty)
-// If the (non-empty) reconnectToken is not valid for the current lobby, a new client will be established
-func JoinConnToLobby(ws *websocket.Conn, lobby *Lobby, reconnectToken string) error {
+	id             int          // uniquely identifies the Client within the lobby
+	reconnectToken string       // a randomly generated token sent to the client to be used for reconnecting (guarded by connMut, rotated on every reconnect)
+	tokenExpiresAt time.Time    // when reconnectToken stops being valid, or zero while the client is connected (guarded by connMut)
+	binding        string       // identifies the browser the client joined from, reconnecting requires the same binding (or "" if unbound)
+	ip             string       // the IP address the client joined from (used for bans)
+	spectator      bool         // whether the client is only watching, and isn't part of the turn order (owned by the lobby goroutine)
+	profileId      string       // the id of the player's profile, which their results are recorded to (or "" if they're anonymous)
+	displayName    string       // the display name for the client (shown to other players)
+	iconName       string       // the file name of the icon to show for this client in the lobby
+	lobby          *Lobby       // holds a reference to the lobby that the client is in
+	conn           Conn         // holds a reference to the player's connection (websocket, event stream, etc.)
+	connMut        sync.Mutex   // used to synchronize clearing and re-establishing new conns between client threads
+	write          chan Message // a write channel used by the lobby to pass messages that the client should transmit over its conn
+	disconnected   chan bool    // a channel used by the client's Read and Write goroutines to synchronize disconnects (closed once either disconnects)
+	disconnectOnce sync.Once
+
+	limiter    *messageLimiter // enforces MessageRateLimits on messages from the client (only touched by the Read goroutine)
+	rttSamples []time.Duration // recent round trip times measured during time syncs (only touched by the Read goroutine)
+	rtt        atomic.Int64    // the average of rttSamples in nanoseconds, readable from the lobby goroutine
+
+	lastServerSend atomic.Int64 // ServerSend of the last TimeSync written to the client, until a request reports it back (or 0)
+}
+
+// JoinRequest describes a player's request to join (or rejoin) a lobby
+type JoinRequest struct {
+	ReconnectToken string // rejoin as the existing client with this token, if it's valid
+	Binding        string // identifies the player's browser (e.g. from a signed cookie), or "" if token binding isn't in use
+	IP             string // the player's IP address
+	AccessToken    string // the token from Lobby.GrantAccess for joining a private lobby (not needed to reconnect)
+	Spectate       bool   // join as a spectator rather than a player
+	Profile        *JoinProfile
+}
+
+// JoinProfile is the profile of a player joining a lobby, which sets their display name and icon
+type JoinProfile struct {
+	Id          string
+	DisplayName string
+	IconName    string
+}
+
+// JoinConnToLobby registers this websocket connection as belonging to a client in the lobby
+// either by creating a new client and connecting, or by re-establishing connection with an existing client (using the request's ReconnectToken if not empty)
+// If the (non-empty) ReconnectToken is not valid for the current lobby, a new client will be established
+func JoinConnToLobby(ws *websocket.Conn, lobby *Lobby, request JoinRequest) error {
 	if ws == nil {
 		return errors.New("websocket connection must already be established")
 	}
 
+	conn := newWsConn(ws)
+	err := JoinToLobby(conn, lobby, request)
+	if reason, rejected := joinRejection(err); rejected {
+		_ = conn.WriteMessage(Message{Type: LobbyClosed, Content: reason})
+	}
+	return err
+}
+
+// JoinToLobby is the transport-agnostic equivalent of JoinConnToLobby, for any Conn implementation
+func JoinToLobby(conn Conn, lobby *Lobby, request JoinRequest) error {
+	if conn == nil {
+		return errors.New("conn must not be nil")
+	}
+
 	if lobby == nil {
 		return errors.New("client must belong to a lobby")
 	}
 
+	if lobby.IsBanned(request) {
+		return ErrBanned
+	}
+
 	// attempt to reconnect to an existing client if we have a reconnectToken that matches one of an existingClient
-	if existingClient := lobby.GetClientByReconnectToken(reconnectToken); existingClient != nil {
-		if existingClient.ws == nil {
-			existingClient.ws = ws
+	if existingClient := lobby.GetClientByReconnectToken(request.ReconnectToken); existingClient != nil {
+		if !existingClient.matchesBinding(request.Binding) {
+			return errors.New("reconnect token is bound to a different browser")
+		}
+
+		existingClient.connMut.Lock()
+		defer existingClient.connMut.Unlock()
+		if existingClient.conn == nil {
+			existingClient.conn = conn
+			existingClient.reconnectToken = generateReconnectToken() // the old token may have leaked, the new one is sent in the catch-up ClientDetails
+			existingClient.tokenExpiresAt = time.Time{}
 			return nil
 		} else {
 			return errors.New("client is already present in the lobby")
 		}
 	}
 
+	if err := lobby.access.admit(request.AccessToken); err != nil {
+		return err
+	}
+
 	Id := lobby.GetNextClientId()
 	client := &Client{
 		id:             Id,
 		reconnectToken: generateReconnectToken(),
+		binding:        request.Binding,
+		ip:             request.IP,
+		spectator:      request.Spectate,
 		displayName:    fmt.Sprintf("Player %d", Id),
 		iconName:       lobby.GetDefaultIconName(Id),
 		lobby:          lobby,
-		ws:             ws,
-		wsMut:          sync.Mutex{},
+		conn:           conn,
+		connMut:        sync.Mutex{},
 		write:          make(chan Message),
 		disconnected:   make(chan bool),
+		limiter:        newMessageLimiter(),
+	}
+	if request.Profile != nil {
+		client.profileId = request.Profile.Id
+		client.displayName = request.Profile.DisplayName
+		client.iconName = request.Profile.IconName
 	}
 
 	go client.Write()
 	go client.Read()
-	lobby.join <- client
 
-	return nil
+	// the lobby may have ended (e.g. nobody joined in time) while it was still listed
+	select {
+	case lobby.join <- client:
+		return nil
+	case <-lobby.done:
+		client.disconnectOnce.Do(func() { close(client.disconnected) })
+		return ErrLobbyEnded
+	}
 }
 
 func (c *Client) Write() {
@@ -75,11 +153,24 @@ func (c *Client) Write() {
 	for {
 		select {
 		case message := <-c.write:
-			c.wsMut.Lock()
-			if c.ws != nil {
-				_ = c.ws.WriteJSON(message)
+			if message.Type == TimeSync {
+				// stamp as late as possible, so the client's round trip estimate doesn't include time spent waiting to be written
+				content := message.Content.(TimeSyncContent)
+				content.ServerSend = time.Now().UnixMilli()
+				message.Content = content
+				c.lastServerSend.Store(content.ServerSend)
 			}
-			c.wsMut.Unlock()
+
+			c.connMut.Lock()
+			if c.conn != nil {
+				if err := c.conn.WriteMessage(message); err != nil {
+					c.lobby.logger.Printf("Failed to write %s to %s: %v", message, c, err)
+				}
+				if message.closeAfter {
+					_ = c.conn.Close()
+				}
+			}
+			c.connMut.Unlock()
 		case <-c.disconnected:
 			return
 		}
@@ -99,31 +190,45 @@ func (c *Client) Read() {
 		}
 
 		var message Message
-		err := c.ws.ReadJSON(&message)
+		err := c.conn.ReadMessage(&message)
+		receivedAt := time.Now()
 
 		// no connection issue
 		if err == nil {
+			if !c.limiter.allow(message) {
+				c.onRateLimited(message)
+				continue
+			}
+
+			if message.Type == TimeSyncReq {
+				// answered here rather than by the lobby, so the timestamps aren't skewed by time spent waiting on the lobby
+				c.onTimeSyncReq(message, receivedAt)
+				continue
+			}
+
 			message.From = c.id
-			c.lobby.read <- message
+			message.receivedAt = receivedAt
+			c.sendToLobby(message)
 			continue
 		}
 
 		// unrecoverable connection issue
-		if !isRecoverableWsError(err) {
+		if !errors.Is(err, ErrConnLost) {
 			c.lobby.logger.Printf("%s has disconnected. Won't wait for reconnection due to: %v", c, err)
 			return
 		}
 
 		// recoverable connection issue
-		c.wsMut.Lock()
-		_ = c.ws.Close()
-		c.ws = nil
-		c.wsMut.Unlock()
+		c.connMut.Lock()
+		_ = c.conn.Close()
+		c.conn = nil
+		c.tokenExpiresAt = time.Now().Add(reconnectionTimeout)
+		c.connMut.Unlock()
 
 		c.lobby.logger.Printf("%s has disconnected. Waiting for reconnection...", c)
-		if c.awaitRecovery() {
+		if c.awaitRecovery(reconnectionTimeout) {
 			c.lobby.logger.Printf("%s has reconnected", c)
-			c.lobby.read <- Message{Type: ClientDetailsReq, From: c.id} // ask the server for a full catch-up of what's been missed
+			c.sendToLobby(Message{Type: ClientDetailsReq, From: c.id}) // ask the server for a full catch-up of what's been missed
 		} else {
 			c.lobby.logger.Printf("%s was not able to recover their connection in time", c)
 			return
@@ -131,14 +236,108 @@ func (c *Client) Read() {
 	}
 }
 
+// getReconnectToken returns the client's current reconnect token
+func (c *Client) getReconnectToken() string {
+	c.connMut.Lock()
+	defer c.connMut.Unlock()
+
+	return c.reconnectToken
+}
+
+// hasReconnectToken reports whether token is the client's current, unexpired reconnect token (compared in constant time)
+func (c *Client) hasReconnectToken(token string) bool {
+	c.connMut.Lock()
+	defer c.connMut.Unlock()
+
+	if !c.tokenExpiresAt.IsZero() && time.Now().After(c.tokenExpiresAt) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(c.reconnectToken), []byte(token)) == 1
+}
+
+// matchesBinding reports whether a request with the given binding may act as this client
+func (c *Client) matchesBinding(binding string) bool {
+	return c.binding == "" || subtle.ConstantTimeCompare([]byte(c.binding), []byte(binding)) == 1
+}
+
+// send passes a message to the Write goroutine to be transmitted, unless it has already stopped (the client is on its way
+// out of the lobby). All messages to the client should go through here, so the lobby and Read goroutines can't block on a client that has gone
+func (c *Client) send(message Message) {
+	select {
+	case c.write <- message:
+	case <-c.disconnected:
+	}
+}
+
+// sendToLobby passes a message to the lobby, unless the lobby has already ended
+func (c *Client) sendToLobby(message Message) {
+	select {
+	case c.lobby.read <- message:
+	case <-c.lobby.done:
+	}
+}
+
+func (c *Client) onTimeSyncReq(message Message, receivedAt time.Time) {
+	content, ok := contentAs[TimeSyncContent](message.Content)
+	if !ok {
+		return
+	}
+
+	// only trust timestamps from the response we last sent this client, and only once, so a client can't make up a round trip
+	if content.LastServerSend > 0 && c.lastServerSend.CompareAndSwap(content.LastServerSend, 0) {
+		// the time since we sent the previous response, minus however long the client held onto it before sending this request
+		sinceLastSend := receivedAt.Sub(time.UnixMilli(content.LastServerSend))
+		clientHold := time.Duration(content.ClientSend-content.LastClientReceive) * time.Millisecond
+		if clientHold >= 0 {
+			c.recordRtt(sinceLastSend - clientHold)
+		}
+	}
+
+	c.send(Message{Type: TimeSync, Content: TimeSyncContent{
+		ClientSend:    content.ClientSend,
+		ServerReceive: receivedAt.UnixMilli(),
+		// ServerSend is filled in by Write, right before the message goes out
+	}})
+}
+
+func (c *Client) recordRtt(sample time.Duration) {
+	if sample < 0 {
+		return
+	}
+
+	if average := c.getRtt(); average > 0 {
+		sample = min(sample, rttOutlierFactor*average)
+	}
+
+	c.rttSamples = append(c.rttSamples, sample)
+	if len(c.rttSamples) > rttSampleCount {
+		c.rttSamples = c.rttSamples[1:]
+	}
+
+	var total time.Duration
+	for _, s := range c.rttSamples {
+		total += s
+	}
+	c.rtt.Store(int64(total) / int64(len(c.rttSamples)))
+}
+
+// getRtt returns the client's measured round trip time, or 0 if it hasn't been measured yet
+func (c *Client) getRtt() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
 // awaitRecovery returns true if the client connection has been recovered, or false if the connection took too long to be recoverd
-func (c *Client) awaitRecovery() bool {
+func (c *Client) awaitRecovery(reconnectionTimeout time.Duration) bool {
 	ticker := time.Tick(50 * time.Millisecond)
 	timeout := time.After(reconnectionTimeout)
 	for {
 		select {
 		case <-ticker:
-			if c.ws != nil {
+			c.connMut.Lock()
+			recovered := c.conn != nil
+			c.connMut.Unlock()
+			if recovered {
 				return true
 			}
 		case <-timeout:
@@ -147,27 +346,47 @@ func (c *Client) awaitRecovery() bool {
 	}
 }
 
+// resume starts the goroutines for a client restored from a snapshot, who has no connection yet.
+// Once they reconnect it carries on like any other client, and if they don't reconnect in time they leave the lobby
+func (c *Client) resume() {
+	go c.Write()
+	go func() {
+		if !c.awaitRecovery(restoredReconnectionTimeout) {
+			c.lobby.logger.Printf("%s did not reconnect to the restored lobby in time", c)
+			c.close()
+			return
+		}
+
+		c.lobby.logger.Printf("%s has reconnected to the restored lobby", c)
+		c.sendToLobby(Message{Type: ClientDetailsReq, From: c.id})
+		c.Read()
+	}()
+}
+
 func (c *Client) close() {
 	if r := recover(); r != nil {
 		fmt.Printf("Client.close() recovered from: %v\n", r)
 	}
 
-	c.disconnected <- true // tell the other client goroutine to disconnect
-	c.lobby.leave <- c     // tell the lobby we've left
+	c.disconnectOnce.Do(func() { close(c.disconnected) }) // tell the other client goroutine to disconnect
 
-	if c.ws != nil {
-		_ = c.ws.Close()
+	// tell the lobby we've left (unless it has already ended)
+	select {
+	case c.lobby.leave <- c:
+	case <-c.lobby.done:
 	}
+
+	c.connMut.Lock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.connMut.Unlock()
 }
 
 func (c *Client) String() string {
 	return fmt.Sprintf("Client[id=%d, displayName='%s']", c.id, c.displayName)
 }
 
-func isRecoverableWsError(err error) bool {
-	return websocket.IsCloseError(err, recoverableWsErrors...)
-}
-
 func generateReconnectToken() string {
 	tokenBytes := make([]byte, 32)
 
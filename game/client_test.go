@@ -0,0 +1,45 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSyncIgnoresUntrustedSamples(t *testing.T) {
+	client := &Client{write: make(chan Message, 10), disconnected: make(chan bool)}
+	serverSend := time.Now().UnixMilli()
+
+	// timeSync sends serverSend to the client, which reports back lastServerSend having held it for hold (in milliseconds)
+	// and taken roundTrip in total to get it and reply
+	timeSync := func(lastServerSend int64, hold int64, roundTrip int64) {
+		client.lastServerSend.Store(serverSend)
+		client.onTimeSyncReq(Message{Type: TimeSyncReq, Content: TimeSyncContent{
+			LastServerSend:    lastServerSend,
+			LastClientReceive: 1_000,
+			ClientSend:        1_000 + hold,
+		}}, time.UnixMilli(serverSend+hold+roundTrip))
+	}
+
+	timeSync(serverSend-1, 0, 100) // a response we never sent
+	timeSync(serverSend, -50, 100) // a negative hold
+	if rtt := client.getRtt(); rtt != 0 {
+		t.Fatalf("rtt = %s after untrusted samples, want none", rtt)
+	}
+
+	timeSync(serverSend, 20, 100)
+	if rtt := client.getRtt(); rtt != 100*time.Millisecond {
+		t.Fatalf("rtt = %s, want 100ms", rtt)
+	}
+
+	// the same response can't be reported twice
+	client.onTimeSyncReq(Message{Type: TimeSyncReq, Content: TimeSyncContent{LastServerSend: serverSend, LastClientReceive: 1_000, ClientSend: 1_000}}, time.UnixMilli(serverSend+10_000))
+	if len(client.rttSamples) != 1 {
+		t.Errorf("recorded %d samples, want the replayed one ignored", len(client.rttSamples))
+	}
+
+	// far slower than the average so far, so it's clamped
+	timeSync(serverSend, 0, 10_000)
+	if rtt := client.getRtt(); rtt != 200*time.Millisecond {
+		t.Errorf("rtt = %s after an outlier, want 200ms (the average of 100ms and 300ms)", rtt)
+	}
+}
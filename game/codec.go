@@ -0,0 +1,79 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Subprotocols lists the websocket subprotocols the server understands, in order of preference
+// a client that doesn't request any subprotocol is spoken to in JSON
+var Subprotocols = []string{msgpackCodec{}.Name(), jsonCodec{}.Name()}
+
+// Codec controls how a Message is encoded on the wire. Both encodings share the same Message types
+type Codec interface {
+	Name() string                   // the websocket subprotocol that selects this codec
+	FrameType() int                 // the websocket frame type used for encoded messages (text or binary)
+	Encode(Message) ([]byte, error) // encodes a message to be written to the client
+	Decode([]byte, *Message) error  // decodes a message read from the client
+}
+
+// CodecForSubprotocol returns the codec negotiated for a websocket connection, falling back to JSON
+func CodecForSubprotocol(subprotocol string) Codec {
+	switch subprotocol {
+	case msgpackCodec{}.Name():
+		return msgpackCodec{}
+	default:
+		return jsonCodec{}
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) Encode(message Message) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) Decode(data []byte, message *Message) error {
+	return json.Unmarshal(data, message)
+}
+
+// msgpackHandle is shared by all msgpack codecs, handles are safe for concurrent use once configured
+var msgpackHandle = newMsgpackHandle()
+
+func newMsgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true} // use the newer msgpack spec so strings and binary data are distinguishable
+	handle.RawToString = true
+	handle.MapType = reflect.TypeOf(map[string]any(nil)) // decode maps the same way encoding/json does
+	return handle
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) Encode(message Message) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(message)
+	return data, err
+}
+
+func (msgpackCodec) Decode(data []byte, message *Message) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(message)
+}
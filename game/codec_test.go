@@ -0,0 +1,253 @@
+package game
+
+import (
+	"compress/flate"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	benchmarkPlayers = 10
+	benchmarkTurns   = 30
+)
+
+// benchmarkGame is the mix of messages a player receives over a typical 10 player game: catching up on the lobby as
+// they join, everyone else joining, then every turn's time sync, challenge, answer previews and result
+func benchmarkGame() []Message {
+	now := time.Now().UnixMilli()
+	clients := make([]ClientContent, 0, benchmarkPlayers)
+	for id := 1; id <= benchmarkPlayers; id++ {
+		clients = append(clients, ClientContent{Id: id, DisplayName: fmt.Sprintf("Player %d", id), IconName: fmt.Sprintf("icon%d.svg", id), Alive: true})
+	}
+
+	messages := []Message{{Type: ClientDetails, Content: ClientDetailsContent{
+		ClientId:       1,
+		ReconnectToken: generateReconnectToken(),
+		Status:         WaitingForPlayers,
+		HostId:         1,
+		Settings:       defaultGameSettings,
+		Clients:        clients[:1],
+		Now:            now,
+	}}}
+	for _, c := range clients[1:] {
+		messages = append(messages, Message{Type: ClientJoined, Content: ClientJoinedContent{ClientId: c.Id, DisplayName: c.DisplayName, IconName: c.IconName, Alive: true}})
+	}
+	messages = append(messages, Message{Type: StartGame})
+
+	answers := []string{"categorically", "atrocious", "partner", "strategic", "ingredient", "consonant"}
+	for turn := range benchmarkTurns {
+		answer := answers[turn%len(answers)]
+		messages = append(messages,
+			Message{Type: TimeSync, Content: TimeSyncContent{ClientSend: now - 40, ServerReceive: now - 20, ServerSend: now}},
+			Message{Type: ClientsTurn, Content: ClientsTurnContent{ClientId: turn%benchmarkPlayers + 1, Challenge: answer[2:5], TurnEnd: now + 10_000, Now: now}},
+		)
+		for i := 1; i <= len(answer); i++ {
+			messages = append(messages, Message{Type: AnswerPreview, Content: answer[:i]})
+		}
+
+		if turn%4 == 3 {
+			messages = append(messages, Message{Type: TurnExpired, Content: TurnExpiredContent{
+				EliminatedClientId: turn%benchmarkPlayers + 1,
+				Eliminated:         true,
+				Suggestions:        []string{"atrium", "patrol", "matrix", "citrus", "nitrate"},
+			}})
+		} else {
+			messages = append(messages, Message{Type: AnswerAccepted, Content: answer})
+		}
+	}
+	return messages
+}
+
+// BenchmarkWebsocketGame sends a typical game's messages over a real websocket, with each codec and with compression
+// off and at each level. It reports the bytes read off the wire (frame headers included) per game as wire-B/op
+func BenchmarkWebsocketGame(b *testing.B) {
+	settings := []struct {
+		name        string
+		compression bool
+		level       int
+	}{
+		{name: "uncompressed"},
+		{name: "huffman-only", compression: true, level: flate.HuffmanOnly},
+		{name: "best-speed", compression: true, level: flate.BestSpeed}, // the default WS_COMPRESSION_LEVEL
+		{name: "default", compression: true, level: flate.DefaultCompression},
+		{name: "best-compression", compression: true, level: flate.BestCompression},
+	}
+	messages := benchmarkGame()
+
+	for _, codec := range []Codec{jsonCodec{}, msgpackCodec{}} {
+		for _, setting := range settings {
+			b.Run(codec.Name()+"/"+setting.name, func(b *testing.B) {
+				server, client, wireBytes := websocketPair(b, codec, setting.compression, setting.level)
+
+				b.ResetTimer()
+				wireBytes.Store(0)
+				for range b.N {
+					for _, message := range messages {
+						if err := server.WriteMessage(message); err != nil {
+							b.Fatal(err)
+						}
+						if _, _, err := client.ReadMessage(); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				b.StopTimer()
+
+				b.ReportMetric(float64(wireBytes.Load())/float64(b.N), "wire-B/op")
+			})
+		}
+	}
+}
+
+// websocketPair connects a client to a server over a real websocket, negotiating codec and (optionally) compression
+// at level like the server does. Returns the server's end of the connection, the client's, and a count of the bytes the client has read
+func websocketPair(b *testing.B, codec Codec, compression bool, level int) (*wsConn, *websocket.Conn, *atomic.Int64) {
+	upgrader := websocket.Upgrader{EnableCompression: compression, Subprotocols: Subprotocols}
+	accepted := make(chan *websocket.Conn, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		if compression {
+			_ = ws.SetCompressionLevel(level)
+		}
+		accepted <- ws
+	}))
+	b.Cleanup(httpServer.Close)
+
+	wireBytes := &atomic.Int64{}
+	dialer := websocket.Dialer{
+		EnableCompression: compression,
+		Subprotocols:      []string{codec.Name()},
+		NetDialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &countingConn{Conn: conn, read: wireBytes}, nil
+		},
+	}
+
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = client.Close() })
+
+	ws := <-accepted
+	b.Cleanup(func() { _ = ws.Close() })
+	if ws.Subprotocol() != codec.Name() {
+		b.Fatalf("negotiated %q, want %q", ws.Subprotocol(), codec.Name())
+	}
+	return newWsConn(ws), client, wireBytes
+}
+
+// countingConn counts the bytes read from a connection
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// TestMsgpackClientMessages sends every kind of message a client sends through the msgpack codec, with the content
+// shaped like the browser sends it, and checks the lobby acts on each one like it does for JSON
+func TestMsgpackClientMessages(t *testing.T) {
+	lobby := NewLobby("msgpack-test", make(chan string, 1))
+	go lobby.StartLobby()
+
+	host := joinLocal(t, lobby)
+	receive(t, host, ClientDetails)
+	guest := joinLocal(t, lobby)
+	guestId := receive(t, guest, ClientDetails).Content.(ClientDetailsContent).ClientId
+	spectator := joinLocal(t, lobby)
+	spectatorId := receive(t, spectator, ClientDetails).Content.(ClientDetailsContent).ClientId
+
+	sendMsgpack(t, guest, Message{Type: NameChange, Content: "Renamed"})
+	if changed := receive(t, host, NameChange).Content.(ClientNameChangeContent); changed != (ClientNameChangeContent{ClientId: guestId, NewDisplayName: "Renamed"}) {
+		t.Errorf("name change = %+v", changed)
+	}
+
+	sendMsgpack(t, guest, Message{Type: ClientDetailsReq})
+	if details := receive(t, guest, ClientDetails).Content.(ClientDetailsContent); details.ClientId != guestId {
+		t.Errorf("client details are for client %d, want %d", details.ClientId, guestId)
+	}
+
+	clientSend := time.Now().UnixMilli()
+	sendMsgpack(t, guest, Message{Type: TimeSyncReq, Content: map[string]any{"ClientSend": clientSend}})
+	if timeSync := receive(t, guest, TimeSync).Content.(TimeSyncContent); timeSync.ClientSend != clientSend || timeSync.ServerSend == 0 {
+		t.Errorf("time sync = %+v, want ClientSend %d", timeSync, clientSend)
+	}
+
+	sendMsgpack(t, host, Message{Type: ChangeSettings, Content: map[string]any{"Mode": string(Scoring), "Rounds": 3, "TargetScore": 50, "Seed": 0}})
+	if settings := receive(t, guest, ChangeSettings).Content.(GameSettings); settings != (GameSettings{Mode: Scoring, Rounds: 3, TargetScore: 50}) {
+		t.Errorf("settings = %+v", settings)
+	}
+
+	for _, spectate := range []bool{true, false} {
+		sendMsgpack(t, spectator, Message{Type: SpectateChange, Content: spectate})
+		if changed := receive(t, host, SpectateChange).Content.(SpectateChangeContent); changed != (SpectateChangeContent{ClientId: spectatorId, Spectator: spectate}) {
+			t.Errorf("spectate change = %+v, want spectating %t", changed, spectate)
+		}
+	}
+
+	sendMsgpack(t, host, Message{Type: KickClient, Content: spectatorId})
+	if left := receive(t, host, ClientLeft).Content; left != spectatorId {
+		t.Errorf("client %v left, want the kicked client %d", left, spectatorId)
+	}
+
+	sendMsgpack(t, host, Message{Type: StartGame})
+	turn := receive(t, host, ClientsTurn).Content.(ClientsTurnContent)
+	player, opponent := host, guest
+	if turn.ClientId == guestId {
+		player, opponent = guest, host
+	}
+
+	answer := answerFor(t, turn.Challenge)
+	sendMsgpack(t, player, Message{Type: AnswerPreview, Content: answer[:1]})
+	if preview := receive(t, opponent, AnswerPreview).Content; preview != answer[:1] {
+		t.Errorf("answer preview = %v, want %q", preview, answer[:1])
+	}
+
+	sendMsgpack(t, player, Message{Type: SubmitAnswer, Content: answer})
+	if accepted := receive(t, opponent, AnswerAccepted).Content; accepted != answer {
+		t.Errorf("accepted answer %v, want %q", accepted, answer)
+	}
+
+	_ = host.Close()
+	_ = guest.Close()
+}
+
+// sendMsgpack sends a message to the lobby as it would arrive from a browser speaking msgpack
+func sendMsgpack(t *testing.T, conn *LocalConn, message Message) {
+	t.Helper()
+
+	data, err := msgpackCodec{}.Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Message
+	if err = (msgpackCodec{}).Decode(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conn.Send(decoded); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,18 @@
+package game
+
+import "errors"
+
+// ErrConnLost is returned (possibly wrapped) by a Conn when the connection dropped in a way the
+// player can recover from, e.g. a browser refresh. The client will wait for them to reconnect
+var ErrConnLost = errors.New("connection lost")
+
+// Conn is one player's connection to a lobby, regardless of how they are connected (websocket, event stream,
+// an in-process bot, a test fake, etc.) A lobby treats every Conn the same way.
+//
+// To reconnect, a player joins again with JoinToLobby using their reconnect token, after their previous
+// Conn returned ErrConnLost
+type Conn interface {
+	ReadMessage(message *Message) error // blocks until the next message from the player arrives
+	WriteMessage(message Message) error // sends a message to the player
+	Close() error                       // closes the underlying connection
+}
@@ -0,0 +1,42 @@
+package game
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// DailyDate returns the date of the daily challenge being played at t, e.g. "2024-02-13". Each day starts at midnight UTC
+func DailyDate(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// dailySeed returns the seed of the date's daily challenge, which is the same on every server
+func dailySeed(date string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte("daily:" + date))
+	return int64(hash.Sum64()%MaxSeed) + 1
+}
+
+// SetDaily makes the lobby a daily challenge for the date: a single player clears as many of the day's challenges as
+// they can before running out of time. It must be called before the lobby starts
+func (lobby *Lobby) SetDaily(date string) {
+	lobby.daily = date
+	lobby.settings = GameSettings{Mode: Daily, Seed: dailySeed(date)}
+	lobby.publishSummary()
+}
+
+// getMinPlayers returns how many players are needed to start a game
+func (lobby *Lobby) getMinPlayers() int {
+	if lobby.daily != "" {
+		return 1
+	}
+	return 2
+}
+
+// getMaxPlayers returns how many players the lobby has room for
+func (lobby *Lobby) getMaxPlayers() int {
+	if lobby.daily != "" {
+		return 1
+	}
+	return MaxPlayers
+}
@@ -1,24 +1,44 @@
 package game
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"maps"
+	"math/rand/v2"
 	"os"
 	"runtime/debug"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jhshelnu/wordcraft/icons"
 	"github.com/jhshelnu/wordcraft/words"
 )
 
 const (
 	MaxDisplayName = 15
+
+	answerPreviewInterval = 100 * time.Millisecond // the minimum time between AnswerPreview broadcasts for a lobby
+)
+
+// EmptyLobbyTimeout is how long a lobby waits for its first client before closing, and IdleLobbyTimeout is how long a
+// lobby waits without any messages while not in a game before warning its clients that it will close.
+// Both can be overridden at startup
+var (
+	EmptyLobbyTimeout = 5 * time.Minute
+	IdleLobbyTimeout  = 15 * time.Minute
 )
 
+const idleWarningPeriod = 1 * time.Minute // how long after the idle warning the lobby closes, unless something happens
+
+var ErrLobbyEnded = errors.New("lobby has already ended")
+
+// AnswerGraceWindow caps how long after a turn ends the lobby keeps waiting for an answer that was (judging by the
+// client's measured round trip time) submitted in time. It can be overridden at startup, 0 disables latency compensation
+var AnswerGraceWindow = 500 * time.Millisecond
+
 //go:generate go run golang.org/x/tools/cmd/stringer -type gameStatus
 type gameStatus int
 
@@ -33,23 +53,51 @@ type Lobby struct {
 
 	logger *log.Logger
 
-	join  chan *Client // channel for new clients to join the lobby
-	leave chan *Client // channel for existing clients to leave the lobby
-	read  chan Message // channel for existing clients to send messages for the Lobby to read
+	join  chan *Client  // channel for new clients to join the lobby
+	leave chan *Client  // channel for existing clients to leave the lobby
+	read  chan Message  // channel for existing clients to send messages for the Lobby to read
+	drain chan bool     // channel for the server to ask the lobby to wind down (true to shut down immediately, without finishing the game)
+	done  chan struct{} // closed once the lobby has ended
+
+	snapshotReq chan snapshotRequest // channel for the server to request a snapshot of the lobby's state
 
 	iconNames []string // a slice of icon file names (shuffled for each lobby)
 
+	lobbySeed int64      // the seed iconNames were shuffled with, which stays the same across games
+	seed      int64      // the seed of the current (or last) game, or lobbySeed before the first game
+	rngSource *rand.PCG  // the source of rng, kept so its state can be saved in snapshots
+	rng       *rand.Rand // makes the lobby's random choices, following the sequence produced by seed
+
+	public  bool                         // whether the lobby is listed in the lobby browser and can be found by quick play (set before the lobby starts)
+	daily   string                       // the date of the daily challenge, if the lobby is for one (set before the lobby starts)
+	summary atomic.Pointer[LobbySummary] // the latest summary of the lobby, published by the lobby goroutine for the lobby browser
+
 	// todo: consider refactoring these fields into a game state struct for better code separation
-	clients           map[int]*Client  // all clients in the lobby, indexed by their id
-	aliveClients      []*Client        // all clients in the lobby who are not out
-	status            gameStatus       // the status of the game, indicates if its started, in progress, etc
-	turnIndex         int              // the index in aliveClients of whose turn it is
-	turnRounds        int              // how many times the turn has changed to the first player (lowest client id)
-	currentChallenge  string           // the current challenge string for clientsTurn
-	currentAnswerPrev string           // preview of what the client whose turn it is has typed so far
-	currentTurnEnd    int64            // when the current turn ends, in milliseconds from the unix epoch (UTC)
-	turnExpired       <-chan time.Time // a (read-only) channel which produces a single boolean value once the client has run out of time
-	winnersName       string           // the name of the winning client (captured at the moment they won) this is for new clients joining after the game
+	clients           map[int]*Client      // all clients in the lobby, indexed by their id (only written by the lobby goroutine, holding clientsMut)
+	clientsMut        sync.RWMutex         // lets other goroutines (e.g. joining players looking up their reconnect token) read clients safely
+	hostId            int                  // the id of the client who may start the game and kick or ban other clients
+	bans              *banList             // players who have been banned from the lobby
+	access            *lobbyAccess         // the password and invite codes needed to join, if the lobby is private
+	aliveClients      []*Client            // all clients in the lobby who are not out
+	status            gameStatus           // the status of the game, indicates if its started, in progress, etc
+	turnIndex         int                  // the index in aliveClients of whose turn it is
+	turnRounds        int                  // how many times the turn has changed to the first player (lowest client id)
+	currentChallenge  string               // the current challenge string for clientsTurn
+	currentAnswerPrev string               // preview of what the client whose turn it is has typed so far
+	currentTurnStart  int64                // when the current turn started, in milliseconds from the unix epoch (UTC)
+	currentTurnEnd    int64                // when the current turn ends, in milliseconds from the unix epoch (UTC)
+	turnExpired       <-chan time.Time     // a (read-only) channel which produces a single boolean value once the client has run out of time
+	lastPreviewSent   time.Time            // when the last AnswerPreview was broadcast, used to coalesce previews
+	previewFlush      <-chan time.Time     // fires when a coalesced AnswerPreview is due to be broadcast (nil if none are pending)
+	winnersName       string               // the name of the winning client (captured at the moment they won) this is for new clients joining after the game
+	settings          GameSettings         // how games in the lobby are played
+	gameStats         map[int]*PlayerStats // how each player is doing in the current (or last) game, indexed by client id
+	tally             map[int]*PlayerStats // how each player has done across every finished game in the lobby, indexed by client id
+	replay            *Replay              // the log of the game in progress (nil if there isn't one, or replays aren't being saved)
+	idleCheck         <-chan time.Time     // fires once the lobby has been idle for too long (nil during a game, where turns keep things moving)
+	idleWarned        bool                 // whether the clients have been warned that the lobby is about to close for being idle
+	draining          bool                 // whether the server is shutting down, in which case no new games may be started
+	shutdownSent      bool                 // whether the clients have been told the lobby is shutting down
 
 	lastClientId  int        // the id of the last client which connected (used to increment Client.id's as they join the lobby)
 	clientIdMutex sync.Mutex // enforces thread-safe access to the nextClientId
@@ -57,20 +105,74 @@ type Lobby struct {
 	lobbyEndChan chan string // channel that lets this lobby notify the main thread that this lobby has completed. This allows the Lobby to get GC'ed
 }
 
+// LobbySummary describes a lobby for the lobby browser
+type LobbySummary struct {
+	Id          string
+	Status      gameStatus
+	Players     int      // how many clients are playing in the lobby
+	MaxPlayers  int      // how many players the lobby has room for
+	Spectators  int      // how many clients are spectating
+	Public      bool     // whether the lobby is listed in the lobby browser
+	Mode        gameMode // the mode the lobby's games are played in
+	Rounds      int      // in scoring mode, how many rounds the lobby's games last (or 0 for no limit)
+	TargetScore int      // in scoring mode, the score which wins the lobby's games (or 0 for no target)
+	Private     bool     // whether a password or invite code is needed to join
+}
+
 func NewLobby(id string, lobbyEndChan chan string) *Lobby {
 	logger := log.New(os.Stdout, fmt.Sprintf("Lobby [%s]: ", id), log.Lshortfile|log.Lmsgprefix)
-	return &Lobby{
+	lobby := &Lobby{
 		logger:       logger,
 		Id:           id,
 		join:         make(chan *Client),
 		leave:        make(chan *Client),
 		read:         make(chan Message),
-		iconNames:    icons.GetShuffledIconNames(),
+		drain:        make(chan bool),
+		done:         make(chan struct{}),
+		snapshotReq:  make(chan snapshotRequest),
 		status:       WaitingForPlayers,
 		clients:      make(map[int]*Client),
+		bans:         newBanList(),
+		access:       newLobbyAccess(),
+		tally:        make(map[int]*PlayerStats),
+		settings:     defaultGameSettings,
 		turnIndex:    -1,
+		idleCheck:    time.After(EmptyLobbyTimeout),
 		lobbyEndChan: lobbyEndChan,
 	}
+	lobby.lobbySeed = newSeed()
+	lobby.shuffleIcons()
+	lobby.setSeed(lobby.lobbySeed)
+	lobby.publishSummary()
+	return lobby
+}
+
+// SetPublic lists the lobby in the lobby browser, and lets quick play put players in it. It must be called before the lobby starts
+func (lobby *Lobby) SetPublic(public bool) {
+	lobby.public = public
+	lobby.publishSummary()
+}
+
+// Summary returns the latest summary of the lobby. It's safe to call from any goroutine
+func (lobby *Lobby) Summary() LobbySummary {
+	return *lobby.summary.Load()
+}
+
+// publishSummary updates the lobby's summary, it must only be called from the lobby goroutine (or before it starts)
+func (lobby *Lobby) publishSummary() {
+	spectators := lobby.getSpectatorCount()
+	lobby.summary.Store(&LobbySummary{
+		Id:          lobby.Id,
+		Status:      lobby.status,
+		Players:     len(lobby.clients) - spectators,
+		MaxPlayers:  lobby.getMaxPlayers(),
+		Spectators:  spectators,
+		Public:      lobby.public,
+		Mode:        lobby.settings.Mode,
+		Rounds:      lobby.settings.Rounds,
+		TargetScore: lobby.settings.TargetScore,
+		Private:     lobby.IsPrivate(),
+	})
 }
 
 func (lobby *Lobby) GetNextClientId() int {
@@ -85,17 +187,17 @@ func (lobby *Lobby) GetDefaultIconName(id int) string {
 	return lobby.iconNames[(id-1)%len(lobby.iconNames)]
 }
 
-func (lobby *Lobby) GetClientCount() int {
-	return len(lobby.clients)
-}
-
 func (lobby *Lobby) GetClientByReconnectToken(reconnectToken string) *Client {
 	if reconnectToken == "" {
 		return nil
 	}
 
+	// this is called from outside the lobby goroutine, while it may be adding or removing clients
+	lobby.clientsMut.RLock()
+	defer lobby.clientsMut.RUnlock()
+
 	for _, c := range lobby.clients {
-		if c.reconnectToken == reconnectToken {
+		if c.hasReconnectToken(reconnectToken) {
 			return c
 		}
 	}
@@ -105,16 +207,19 @@ func (lobby *Lobby) GetClientByReconnectToken(reconnectToken string) *Client {
 
 func (lobby *Lobby) StartLobby() {
 	defer lobby.EndLobby()
+	defer close(lobby.done)
 	defer func() {
 		if r := recover(); r != nil {
 			lobby.logger.Printf("Encountered fatal error: %v\n%s", r, debug.Stack())
 		}
 	}()
 
+	lobby.publishSummary()
 	for {
 		select {
 		case client := <-lobby.join:
 			lobby.onClientJoin(client)
+			lobby.markActivity()
 		case client := <-lobby.leave:
 			lobby.onClientLeave(client)
 			if len(lobby.clients) == 0 {
@@ -123,17 +228,132 @@ func (lobby *Lobby) StartLobby() {
 			}
 		case message := <-lobby.read:
 			lobby.onMessage(message)
+			lobby.markActivity()
 		case <-lobby.turnExpired:
 			lobby.onTurnExpired()
+		case <-lobby.previewFlush:
+			lobby.flushAnswerPreview()
+		case force := <-lobby.drain:
+			lobby.onDrain(force)
+			if len(lobby.clients) == 0 {
+				lobby.logger.Printf("Drained with no clients connected. Goodbye.")
+				return
+			}
+		case request := <-lobby.snapshotReq:
+			lobby.onSnapshotRequest(request)
+		case <-lobby.idleCheck:
+			if len(lobby.clients) == 0 {
+				lobby.logger.Printf("Nobody joined within %s. Goodbye.", EmptyLobbyTimeout)
+				return
+			}
+			lobby.onIdle()
+			if len(lobby.clients) == 0 {
+				lobby.logger.Printf("Closed due to inactivity. Goodbye.")
+				return
+			}
 		}
+
+		lobby.publishSummary()
+	}
+}
+
+// markActivity restarts the idle countdown. During a game there is no countdown, since turns keep the lobby moving
+func (lobby *Lobby) markActivity() {
+	lobby.idleWarned = false
+	if lobby.status == InProgress {
+		lobby.idleCheck = nil
+	} else {
+		lobby.idleCheck = time.After(IdleLobbyTimeout)
 	}
 }
 
-func (lobby *Lobby) BroadcastShutdown() {
-	lobby.BroadcastMessage(Message{Type: Shutdown})
+// onIdle warns the clients the first time the lobby goes idle, and closes their connections if it stays idle
+func (lobby *Lobby) onIdle() {
+	if !lobby.idleWarned {
+		lobby.logger.Printf("No activity for %s, warning clients the lobby will close", IdleLobbyTimeout)
+		lobby.idleWarned = true
+		lobby.idleCheck = time.After(idleWarningPeriod)
+		now := time.Now()
+		lobby.BroadcastMessage(Message{Type: IdleWarning, Content: IdleWarningContent{
+			ClosesAt: now.Add(idleWarningPeriod).UnixMilli(),
+			Now:      now.UnixMilli(),
+		}})
+		return
+	}
+
+	lobby.logger.Printf("Still no activity after warning, closing the lobby")
+	for _, c := range lobby.clients {
+		lobby.closeClient(c, "This lobby was closed due to inactivity")
+	}
+
+	// check again later, in case anyone is still hanging around
+	lobby.idleCheck = time.After(idleWarningPeriod)
+}
+
+// closeClient tells the client why they are being disconnected, and then closes their connection.
+// The client leaves the lobby as usual once their connection is closed
+func (lobby *Lobby) closeClient(client *Client, reason string) {
+	client.connMut.Lock()
+	connected := client.conn != nil
+	client.connMut.Unlock()
+
+	if !connected {
+		// there's no connection to close (they're waiting to reconnect), so they wouldn't leave on their own until their reconnection window closes
+		client.disconnectOnce.Do(func() { close(client.disconnected) })
+		lobby.onClientLeave(client)
+		return
+	}
+
+	client.send(Message{Type: LobbyClosed, Content: reason, closeAfter: true})
+}
+
+// Drain tells the lobby that the server is shutting down. A game in progress is allowed to finish, after which
+// (or right away, if there is no game in progress) the clients are told to leave. The lobby ends once they have
+func (lobby *Lobby) Drain() {
+	select {
+	case lobby.drain <- false:
+	case <-lobby.done:
+	}
+}
+
+// Shutdown tells the clients to leave right away, even if a game is in progress
+func (lobby *Lobby) Shutdown() {
+	select {
+	case lobby.drain <- true:
+	case <-lobby.done:
+	}
+}
+
+func (lobby *Lobby) onDrain(force bool) {
+	if !lobby.draining {
+		lobby.logger.Printf("Draining lobby for server shutdown")
+		lobby.draining = true
+	}
+
+	if force || lobby.status != InProgress {
+		lobby.broadcastShutdown()
+	} else {
+		lobby.logger.Printf("Waiting for the game in progress to finish before shutting down")
+	}
+}
+
+func (lobby *Lobby) broadcastShutdown() {
+	if lobby.shutdownSent {
+		return
+	}
+
+	lobby.shutdownSent = true
+	lobby.BroadcastMessage(Message{Type: Shutdown, Content: ShutdownContent{Resumable: false}})
 }
 
 func (lobby *Lobby) onClientJoin(joiningClient *Client) {
+	// capacity is checked here rather than when the page is opened, since only the lobby goroutine knows how many clients there really are
+	if reason, full := lobby.checkCapacity(joiningClient); full {
+		lobby.logger.Printf("Rejected %s: %s", joiningClient, reason)
+		lobby.closeClient(joiningClient, reason)
+		return
+	}
+
 	lobby.logger.Printf("%s connected", joiningClient)
 
 	// tell all the existing clients about the joiningClient
@@ -141,17 +361,23 @@ func (lobby *Lobby) onClientJoin(joiningClient *Client) {
 		ClientId:    joiningClient.id,
 		DisplayName: joiningClient.displayName,
 		IconName:    joiningClient.iconName,
-		// for new clients, they are considered alive if they join mid-game or after the game
-		Alive: lobby.status != InProgress,
+		// for new clients, they are considered alive if they join mid-game or after the game (unless they're spectating)
+		Alive:     lobby.status != InProgress && !joiningClient.spectator,
+		Spectator: joiningClient.spectator,
 	}})
 
+	lobby.clientsMut.Lock()
 	lobby.clients[joiningClient.id] = joiningClient
-	if lobby.status != InProgress {
+	lobby.clientsMut.Unlock()
+	if _, exists := lobby.clients[lobby.hostId]; !exists {
+		lobby.hostId = joiningClient.id // the first client to join is the host
+	}
+	if lobby.status != InProgress && !joiningClient.spectator {
 		lobby.aliveClients = append(lobby.aliveClients, joiningClient)
 	}
 
 	// then tell the joiningClient about the entire state of the game
-	joiningClient.write <- Message{Type: ClientDetails, Content: lobby.buildClientDetails(joiningClient)}
+	joiningClient.send(Message{Type: ClientDetails, Content: lobby.buildClientDetails(joiningClient)})
 }
 
 func (lobby *Lobby) onClientLeave(leavingClient *Client) {
@@ -163,8 +389,11 @@ func (lobby *Lobby) onClientLeave(leavingClient *Client) {
 
 	lobby.logger.Printf("%s disconnected", leavingClient)
 
+	lobby.clientsMut.Lock()
 	delete(lobby.clients, leavingClient.id)
+	lobby.clientsMut.Unlock()
 	lobby.BroadcastMessage(Message{Type: ClientLeft, Content: leavingClient.id})
+	lobby.assignHost()
 
 	// the rest of the code in here is concerned with leaving aliveClients in a consistent state (and declaring a winner if necessary)
 	// if the leaving client is already eliminated, then there is nothing left to do
@@ -179,7 +408,7 @@ func (lobby *Lobby) onClientLeave(leavingClient *Client) {
 	}
 
 	// but, if the game is in progress, then potentially a winner needs to be declared
-	if len(lobby.aliveClients) == 2 {
+	if len(lobby.aliveClients) == lobby.getMinPlayers() {
 		lobby.aliveClients = slices.DeleteFunc(lobby.aliveClients, func(c *Client) bool { return c == leavingClient })
 		lobby.endGame()
 		return
@@ -205,6 +434,12 @@ func (lobby *Lobby) onClientLeave(leavingClient *Client) {
 }
 
 func (lobby *Lobby) onMessage(message Message) {
+	// clients which were turned away (e.g. because the lobby was full) keep reading until their conn closes,
+	// but the handlers assume the sender is in the lobby
+	if _, exists := lobby.clients[message.From]; !exists {
+		return
+	}
+
 	switch message.Type {
 	case StartGame:
 		lobby.onStartGame(message)
@@ -218,6 +453,14 @@ func (lobby *Lobby) onMessage(message Message) {
 		lobby.onNameChange(message)
 	case ClientDetailsReq:
 		lobby.onClientDetailsReq(message)
+	case KickClient:
+		lobby.onKickClient(message)
+	case BanClient:
+		lobby.onBanClient(message)
+	case SpectateChange:
+		lobby.onSpectateChange(message)
+	case ChangeSettings:
+		lobby.onChangeSettings(message)
 	default:
 		lobby.logger.Printf("Received message with type %s. Ignoring due to no handler function", message.Type)
 	}
@@ -229,27 +472,37 @@ func (lobby *Lobby) onTurnExpired() {
 		return
 	}
 
+	// in scoring mode, running out of time only costs the player their turn (in a daily challenge, it ends the game)
+	eliminate := lobby.settings.Mode != Scoring
+
 	eliminatedClient := lobby.aliveClients[lobby.turnIndex]
 	lobby.BroadcastMessage(Message{Type: TurnExpired, Content: TurnExpiredContent{
 		EliminatedClientId: eliminatedClient.id,
+		Eliminated:         eliminate,
 		Suggestions:        words.GetChallengeSuggestions(lobby.currentChallenge),
 	}})
 
-	lobby.changeTurn(true)
+	lobby.changeTurn(eliminate)
 }
 
 func (lobby *Lobby) onStartGame(message Message) {
-	if lobby.status == WaitingForPlayers && len(lobby.clients) >= 2 {
+	if lobby.status == WaitingForPlayers && len(lobby.aliveClients) >= lobby.getMinPlayers() && !lobby.draining && lobby.isHost(message, "start the game") {
 		lobby.logger.Printf("%s has started the game", lobby.clients[message.From])
 		lobby.status = InProgress
+		lobby.startGameStats()
+		lobby.seedGame()
+		lobby.startReplay()
 		lobby.changeTurn(false)
 	}
 }
 
 func (lobby *Lobby) onRestartGame(message Message) {
-	if lobby.status == Over && len(lobby.clients) >= 2 {
+	if lobby.status == Over && lobby.daily == "" && len(lobby.getPlayers()) >= 2 && !lobby.draining && lobby.isHost(message, "restart the game") {
 		lobby.logger.Printf("%s has restarted the game", lobby.clients[message.From])
 		lobby.resetAliveClients()
+		lobby.startGameStats()
+		lobby.seedGame()
+		lobby.startReplay()
 		lobby.status = InProgress
 		lobby.turnIndex = -1
 		lobby.turnRounds = 0
@@ -259,8 +512,13 @@ func (lobby *Lobby) onRestartGame(message Message) {
 }
 
 func (lobby *Lobby) resetAliveClients() {
-	// reset alive clients to hold all clients
-	lobby.aliveClients = slices.SortedFunc(maps.Values(lobby.clients), func(c1 *Client, c2 *Client) int {
+	// reset alive clients to hold all clients (except spectators)
+	lobby.aliveClients = lobby.getPlayers()
+}
+
+// getSortedClients returns all clients sorted by id (ensures ordering of clients is consistent for all players)
+func (lobby *Lobby) getSortedClients() []*Client {
+	return slices.SortedFunc(maps.Values(lobby.clients), func(c1 *Client, c2 *Client) int {
 		return c1.id - c2.id
 	})
 }
@@ -279,19 +537,41 @@ func (lobby *Lobby) onNameChange(message Message) {
 func (lobby *Lobby) onClientDetailsReq(message Message) {
 	client := lobby.clients[message.From]
 	clientDetailsContent := lobby.buildClientDetails(client)
-	client.write <- Message{Type: ClientDetails, Content: clientDetailsContent}
+	client.send(Message{Type: ClientDetails, Content: clientDetailsContent})
 }
 
+// onAnswerPreview records the latest preview, but coalesces the broadcasts so that at most one AnswerPreview
+// is sent every answerPreviewInterval. Whatever the latest value is when the interval elapses is what gets sent
 func (lobby *Lobby) onAnswerPreview(message Message) {
 	if lobby.status == InProgress && message.From == lobby.aliveClients[lobby.turnIndex].id {
 		currentAnswerPrev, ok := message.Content.(string)
-		if ok {
-			lobby.currentAnswerPrev = currentAnswerPrev
-			lobby.BroadcastMessage(Message{Type: AnswerPreview, Content: lobby.currentAnswerPrev})
+		if !ok {
+			return
+		}
+
+		lobby.currentAnswerPrev = currentAnswerPrev
+
+		// a flush is already scheduled, it will pick up the latest value when it fires
+		if lobby.previewFlush != nil {
+			return
+		}
+
+		sinceLastPreview := time.Since(lobby.lastPreviewSent)
+		if sinceLastPreview >= answerPreviewInterval {
+			lobby.flushAnswerPreview()
+		} else {
+			lobby.previewFlush = time.After(answerPreviewInterval - sinceLastPreview)
 		}
 	}
 }
 
+// flushAnswerPreview broadcasts the current answer preview and clears any pending flush
+func (lobby *Lobby) flushAnswerPreview() {
+	lobby.previewFlush = nil
+	lobby.lastPreviewSent = time.Now()
+	lobby.BroadcastMessage(Message{Type: AnswerPreview, Content: lobby.currentAnswerPrev})
+}
+
 func (lobby *Lobby) onAnswerSubmitted(message Message) {
 	if lobby.status == InProgress && message.From == lobby.aliveClients[lobby.turnIndex].id {
 		answer, ok := message.Content.(string)
@@ -299,9 +579,19 @@ func (lobby *Lobby) onAnswerSubmitted(message Message) {
 			return
 		}
 
+		if !lobby.submittedInTime(message) {
+			return
+		}
+
+		// make sure the other clients see the final preview before the answer is accepted or rejected
+		if lobby.previewFlush != nil {
+			lobby.flushAnswerPreview()
+		}
+
 		if !words.IsValidWord(answer) {
 			lobby.logger.Printf("%s submitted '%s' for challenge '%s' - rejected because it's not a word",
 				lobby.aliveClients[lobby.turnIndex], answer, lobby.currentChallenge)
+			lobby.recordRejection(lobby.aliveClients[lobby.turnIndex])
 			lobby.BroadcastMessage(Message{Type: AnswerRejected, Content: answer})
 			return
 		}
@@ -309,6 +599,7 @@ func (lobby *Lobby) onAnswerSubmitted(message Message) {
 		if answer == lobby.currentChallenge {
 			lobby.logger.Printf("%s submitted %s for challenge %s - rejected because it's the same as the challenge",
 				lobby.aliveClients[lobby.turnIndex], answer, lobby.currentChallenge)
+			lobby.recordRejection(lobby.aliveClients[lobby.turnIndex])
 			lobby.BroadcastMessage(Message{Type: AnswerRejected, Content: answer})
 			return
 		}
@@ -316,16 +607,50 @@ func (lobby *Lobby) onAnswerSubmitted(message Message) {
 		if !strings.Contains(answer, lobby.currentChallenge) {
 			lobby.logger.Printf("%s submitted %s for challenge %s - rejected because it does not contain the challenge",
 				lobby.aliveClients[lobby.turnIndex], answer, lobby.currentChallenge)
+			lobby.recordRejection(lobby.aliveClients[lobby.turnIndex])
 			lobby.BroadcastMessage(Message{Type: AnswerRejected, Content: answer})
 			return
 		}
 
 		lobby.logger.Printf("%s submitted %s for challenge %s - accepted", lobby.aliveClients[lobby.turnIndex], answer, lobby.currentChallenge)
+		lobby.recordAnswer(lobby.aliveClients[lobby.turnIndex], answer, message.receivedAt)
 		lobby.BroadcastMessage(Message{Type: AnswerAccepted, Content: answer})
+		if lobby.settings.Mode == Scoring && lobby.awardPoints(lobby.aliveClients[lobby.turnIndex], answer, message.receivedAt) {
+			return // they reached the target score
+		}
 		lobby.changeTurn(false)
 	}
 }
 
+// submittedInTime reports whether a submission should be honoured. Answers arriving after the turn has ended are
+// still honoured if, accounting for the client's latency, they were sent before it ended. The decision is logged for auditing
+func (lobby *Lobby) submittedInTime(message Message) bool {
+	turnEnd := time.UnixMilli(lobby.currentTurnEnd)
+	if message.receivedAt.IsZero() || !message.receivedAt.After(turnEnd) {
+		return true
+	}
+
+	client := lobby.aliveClients[lobby.turnIndex]
+	rtt := client.getRtt()
+	estimatedSentAt := message.receivedAt.Add(-rtt / 2)
+	receivedLateBy := message.receivedAt.Sub(turnEnd)
+
+	if estimatedSentAt.After(turnEnd) {
+		lobby.logger.Printf("%s submitted %s for challenge %s - ignored because it was received %s after the turn ended and sent after it ended (rtt %s)",
+			client, message.Content, lobby.currentChallenge, receivedLateBy, rtt)
+		return false
+	}
+
+	lobby.logger.Printf("%s submitted %s for challenge %s - honoured despite being received %s after the turn ended since it was sent in time (rtt %s)",
+		client, message.Content, lobby.currentChallenge, receivedLateBy, rtt)
+	return true
+}
+
+// getAnswerGrace returns how long past the end of a turn to keep waiting for the client's answer to arrive
+func (lobby *Lobby) getAnswerGrace(client *Client) time.Duration {
+	return min(client.getRtt(), AnswerGraceWindow)
+}
+
 // removeCurrentClient indicates if the client (whose turn it is) has gone out
 // this can happen either by time running out, or by the client disconnecting
 // regardless, it is the responsibility of this method to properly update the aliveClients and turnIndex variables
@@ -346,7 +671,7 @@ func (lobby *Lobby) changeTurn(removeCurrentClient bool) {
 		// - turnIndex can stay the same (since the next client will now occupy that index)
 		//   unless the last client got eliminated, in which case just need to reset the turnIndex to 0
 		lobby.aliveClients = slices.DeleteFunc(lobby.aliveClients, func(c *Client) bool { return c == eliminatedClient })
-		if len(lobby.aliveClients) == 1 {
+		if len(lobby.aliveClients) < lobby.getMinPlayers() {
 			lobby.endGame()
 			return
 		}
@@ -360,12 +685,22 @@ func (lobby *Lobby) changeTurn(removeCurrentClient bool) {
 
 	if lobby.turnIndex == 0 {
 		lobby.turnRounds++
+		if lobby.roundsComplete() {
+			lobby.logger.Printf("All %d rounds have been played", lobby.settings.Rounds)
+			lobby.endGame()
+			return
+		}
 	}
 
+	// any preview still waiting to be sent belongs to the previous turn
+	lobby.previewFlush = nil
+	lobby.currentAnswerPrev = ""
+
 	turnLimitDuration := lobby.getTurnLimitDuration()
+	lobby.currentTurnStart = time.Now().UnixMilli()
 	lobby.currentTurnEnd = time.Now().Add(turnLimitDuration).UnixMilli()
-	lobby.turnExpired = time.After(turnLimitDuration)
-	lobby.currentChallenge = words.GetChallenge(lobby.getTurnDifficulty())
+	lobby.turnExpired = time.After(turnLimitDuration + lobby.getAnswerGrace(lobby.aliveClients[lobby.turnIndex]))
+	lobby.currentChallenge = words.GetChallenge(lobby.rng, lobby.getTurnDifficulty())
 
 	lobby.BroadcastMessage(Message{
 		Type: ClientsTurn,
@@ -378,11 +713,24 @@ func (lobby *Lobby) changeTurn(removeCurrentClient bool) {
 	})
 }
 
-// assumes that lobby.aliveClients == 1 and the winner is lobby.aliveClients[0]
+// in elimination mode, assumes that lobby.aliveClients == 1 and the winner is lobby.aliveClients[0] (daily challenges have no winner)
 func (lobby *Lobby) endGame() {
+	winnerId, winnersName := lobby.getWinner()
 	lobby.status = Over
-	lobby.winnersName = lobby.aliveClients[0].displayName
-	lobby.BroadcastMessage(Message{Type: GameOver, Content: lobby.aliveClients[0].id})
+	lobby.previewFlush = nil
+	lobby.turnExpired = nil
+	lobby.winnersName = winnersName
+	gameOver := lobby.finishGameStats(winnerId)
+	gameOver.ReplayId = lobby.getReplayId()
+	lobby.BroadcastMessage(Message{Type: GameOver, Content: gameOver})
+	lobby.finishReplay()
+	lobby.recordResults(gameOver)
+	lobby.markActivity()
+
+	if lobby.draining {
+		lobby.logger.Printf("Game finished while draining, shutting down")
+		lobby.broadcastShutdown()
+	}
 }
 
 func (lobby *Lobby) getTurnDifficulty() words.ChallengeDifficulty {
@@ -419,17 +767,20 @@ func (lobby *Lobby) buildClientDetails(client *Client) ClientDetailsContent {
 		isAliveMap[c] = true
 	}
 
-	// sorted slice of clients (ensures ordering of clients is consistent for all players)
-	clients := slices.SortedFunc(maps.Values(lobby.clients), func(c1, c2 *Client) int {
-		return c1.id - c2.id
-	})
+	clients := lobby.getSortedClients()
 	clientContents := make([]ClientContent, 0, len(lobby.clients))
 	for _, c := range clients {
+		var score int
+		if stats := lobby.gameStats[c.id]; stats != nil {
+			score = stats.Score
+		}
 		clientContents = append(clientContents, ClientContent{
 			Id:          c.id,
 			DisplayName: c.displayName,
 			IconName:    c.iconName,
 			Alive:       isAliveMap[c],
+			Spectator:   c.spectator,
+			Score:       score,
 		})
 	}
 
@@ -442,9 +793,12 @@ func (lobby *Lobby) buildClientDetails(client *Client) ClientDetailsContent {
 
 	return ClientDetailsContent{
 		ClientId:          client.id,
-		ReconnectToken:    client.reconnectToken,
+		ReconnectToken:    client.getReconnectToken(),
 		Status:            lobby.status,
+		HostId:            lobby.hostId,
+		Settings:          lobby.settings,
 		Clients:           clientContents,
+		SpectatorCount:    lobby.getSpectatorCount(),
 		CurrentTurnId:     currentTurnId,
 		CurrentChallenge:  lobby.currentChallenge,
 		CurrentAnswerPrev: lobby.currentAnswerPrev,
@@ -455,8 +809,9 @@ func (lobby *Lobby) buildClientDetails(client *Client) ClientDetailsContent {
 }
 
 func (lobby *Lobby) BroadcastMessage(message Message) {
+	lobby.recordReplayEvent(message)
 	for _, c := range lobby.clients {
-		c.write <- message
+		c.send(message)
 	}
 }
 
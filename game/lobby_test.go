@@ -0,0 +1,65 @@
+package game
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJoinEndedLobby(t *testing.T) {
+	previous := EmptyLobbyTimeout
+	EmptyLobbyTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { EmptyLobbyTimeout = previous })
+
+	lobbyEndChan := make(chan string, 1)
+	lobby := NewLobby("ended-lobby-test", lobbyEndChan)
+	go lobby.StartLobby()
+	<-lobbyEndChan // nobody joined in time
+
+	joined := make(chan error, 1)
+	go func() { joined <- JoinToLobby(NewLocalConn(), lobby, JoinRequest{}) }()
+
+	select {
+	case err := <-joined:
+		if !errors.Is(err, ErrLobbyEnded) {
+			t.Errorf("joining an ended lobby = %v, want %v", err, ErrLobbyEnded)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatal("joining an ended lobby never returned")
+	}
+}
+
+func TestKickDisconnectedClient(t *testing.T) {
+	lobby := NewLobby("kick-disconnected-test", make(chan string, 1))
+	go lobby.StartLobby()
+
+	host := joinLocal(t, lobby)
+	receive(t, host, ClientDetails)
+	guest := joinLocal(t, lobby)
+	details := receive(t, guest, ClientDetails).Content.(ClientDetailsContent)
+
+	// wait until the guest is waiting to reconnect
+	guest.Drop()
+	client := lobby.GetClientByReconnectToken(details.ReconnectToken)
+	for connected := true; connected; time.Sleep(time.Millisecond) {
+		client.connMut.Lock()
+		connected = client.conn != nil
+		client.connMut.Unlock()
+	}
+
+	kickedAt := time.Now()
+	if err := host.Send(Message{Type: KickClient, Content: details.ClientId}); err != nil {
+		t.Fatal(err)
+	}
+	if left := receive(t, host, ClientLeft).Content; left != details.ClientId {
+		t.Fatalf("client %v left, want the kicked client %d", left, details.ClientId)
+	}
+	if waited := time.Since(kickedAt); waited >= reconnectionTimeout/2 {
+		t.Errorf("kicked client took %s to leave, as if they left once their reconnection window closed", waited)
+	}
+	if lobby.GetClientByReconnectToken(details.ReconnectToken) != nil {
+		t.Error("kicked client can still reconnect")
+	}
+
+	_ = host.Close()
+}
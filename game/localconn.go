@@ -0,0 +1,83 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const localConnBufferSize = 64 // how many messages from the lobby a LocalConn holds before the lobby has to wait on the player
+
+// LocalConn is an in-process Conn, for bots and tests that want to play in a lobby without a real socket.
+// The lobby reads whatever the player Sends, and the player Receives whatever the lobby writes
+type LocalConn struct {
+	toLobby   chan Message  // messages sent by the player, waiting to be read by the lobby
+	toPlayer  chan Message  // messages written by the lobby, waiting to be received by the player
+	done      chan struct{} // closed once the conn is finished, by either side
+	doneErr   error         // why the conn finished, returned from every method once done is closed
+	closeOnce sync.Once
+}
+
+func NewLocalConn() *LocalConn {
+	return &LocalConn{
+		toLobby:  make(chan Message),
+		toPlayer: make(chan Message, localConnBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Send delivers a message from the player to the lobby
+func (c *LocalConn) Send(message Message) error {
+	select {
+	case c.toLobby <- message:
+		return nil
+	case <-c.done:
+		return c.doneErr
+	}
+}
+
+// Receive blocks until the lobby writes the next message to the player
+func (c *LocalConn) Receive() (Message, error) {
+	select {
+	case message := <-c.toPlayer:
+		return message, nil
+	case <-c.done:
+		return Message{}, c.doneErr
+	}
+}
+
+// Drop simulates the player losing their connection in a recoverable way. To reconnect, join the lobby
+// again with a new LocalConn and the player's reconnect token
+func (c *LocalConn) Drop() {
+	c.finish(fmt.Errorf("%w: local conn dropped", ErrConnLost))
+}
+
+func (c *LocalConn) ReadMessage(message *Message) error {
+	select {
+	case *message = <-c.toLobby:
+		return nil
+	case <-c.done:
+		return c.doneErr
+	}
+}
+
+func (c *LocalConn) WriteMessage(message Message) error {
+	select {
+	case c.toPlayer <- message:
+		return nil
+	case <-c.done:
+		return c.doneErr
+	}
+}
+
+func (c *LocalConn) Close() error {
+	c.finish(errors.New("local conn closed"))
+	return nil
+}
+
+func (c *LocalConn) finish(err error) {
+	c.closeOnce.Do(func() {
+		c.doneErr = err
+		close(c.done)
+	})
+}
@@ -0,0 +1,118 @@
+package game
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jhshelnu/wordcraft/icons"
+	"github.com/jhshelnu/wordcraft/words"
+)
+
+const receiveTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	// the word lists and icons are read relative to the root of the repo, like when the server runs
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	if err := words.Init(); err != nil {
+		log.Fatal(err)
+	}
+	if err := icons.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestLocalConnPlaysTurn(t *testing.T) {
+	lobby := NewLobby("local-conn-test", make(chan string, 1))
+	go lobby.StartLobby()
+
+	host := joinLocal(t, lobby)
+	hostId := receive(t, host, ClientDetails).Content.(ClientDetailsContent).ClientId
+
+	guest := joinLocal(t, lobby)
+	guestId := receive(t, guest, ClientDetails).Content.(ClientDetailsContent).ClientId
+	joined := receive(t, host, ClientJoined).Content.(ClientJoinedContent)
+	if joined.ClientId != guestId {
+		t.Fatalf("host was told client %d joined, want %d", joined.ClientId, guestId)
+	}
+
+	if err := host.Send(Message{Type: StartGame}); err != nil {
+		t.Fatal(err)
+	}
+
+	// both players see the same first turn
+	turn := receive(t, host, ClientsTurn).Content.(ClientsTurnContent)
+	if guestTurn := receive(t, guest, ClientsTurn).Content.(ClientsTurnContent); guestTurn != turn {
+		t.Fatalf("players were told about different turns: %+v and %+v", turn, guestTurn)
+	}
+
+	player, opponent, opponentId := host, guest, guestId
+	if turn.ClientId == guestId {
+		player, opponent, opponentId = guest, host, hostId
+	}
+
+	answer := answerFor(t, turn.Challenge)
+	if err := player.Send(Message{Type: SubmitAnswer, Content: answer}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conn := range []*LocalConn{player, opponent} {
+		if accepted := receive(t, conn, AnswerAccepted); accepted.Content != answer {
+			t.Errorf("accepted answer %v, want %q", accepted.Content, answer)
+		}
+		if next := receive(t, conn, ClientsTurn).Content.(ClientsTurnContent); next.ClientId != opponentId {
+			t.Errorf("next turn is client %d's, want %d's", next.ClientId, opponentId)
+		}
+	}
+
+	_ = host.Close()
+	_ = guest.Close()
+}
+
+// joinLocal joins a new player to the lobby over a LocalConn
+func joinLocal(t *testing.T, lobby *Lobby) *LocalConn {
+	t.Helper()
+
+	conn := NewLocalConn()
+	if err := JoinToLobby(conn, lobby, JoinRequest{}); err != nil {
+		t.Fatalf("failed to join lobby: %v", err)
+	}
+	return conn
+}
+
+// receive skips messages until one of the given type arrives, failing the test if it takes too long
+func receive(t *testing.T, conn *LocalConn, messageType messageType) Message {
+	t.Helper()
+
+	timeout := time.AfterFunc(receiveTimeout, func() { _ = conn.Close() })
+	defer timeout.Stop()
+
+	for {
+		message, err := conn.Receive()
+		if err != nil {
+			t.Fatalf("gave up waiting for %s: %v", messageType, err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// answerFor returns a valid answer to the challenge
+func answerFor(t *testing.T, challenge string) string {
+	t.Helper()
+
+	for _, suggestion := range words.GetChallengeSuggestions(challenge) {
+		if suggestion != challenge && words.IsValidWord(suggestion) {
+			return suggestion
+		}
+	}
+
+	t.Fatalf("no known answer for challenge %q", challenge)
+	return ""
+}
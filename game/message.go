@@ -1,6 +1,10 @@
 package game
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type messageType string
 
@@ -21,18 +25,47 @@ const (
 	RestartGame      messageType = "restart_game"       // sent from a client to initiate a game restart. sever then rebroadcasts to all clients to confirm
 	NameChange       messageType = "name_change"        // used by clients to indicate they want a new display name
 	Shutdown         messageType = "shutdown"           // tells the clients the server is being shutdown now
+	TimeSyncReq      messageType = "time_sync_req"      // sent from a client to sample the server's clock (answered directly by the client's goroutine, not the lobby)
+	TimeSync         messageType = "time_sync"          // the server's response to a TimeSyncReq
+	IdleWarning      messageType = "idle_warning"       // warns the clients that the lobby will close soon unless something happens
+	LobbyClosed      messageType = "lobby_closed"       // tells a client the lobby is closing their connection, and why
+	Error            messageType = "error"              // tells a client something they did was not allowed
+	HostChanged      messageType = "host_changed"       // a new client has become the host (after the previous host left)
+	KickClient       messageType = "kick_client"        // sent from the host to remove a client from the lobby
+	BanClient        messageType = "ban_client"         // sent from the host to remove a client from the lobby, and stop them from rejoining
+	SpectateChange   messageType = "spectate_change"    // sent from a client to start or stop spectating. server then rebroadcasts to all clients to confirm
+	ChangeSettings   messageType = "change_settings"    // sent from the host to change the game settings. server then rebroadcasts to all clients to confirm
+	PointsAwarded    messageType = "points_awarded"     // an accepted answer has earned points (scoring mode only)
 )
 
 type Message struct {
 	From    int         // id of the Client in the lobby
 	Type    messageType // content of the message
 	Content any         // any additional info, e.g. which client joined, what their answer is, etc
+
+	receivedAt time.Time // when the server read the message off the client's conn (not sent over the wire)
+	closeAfter bool      // whether to close the client's conn once this message has been written (not sent over the wire)
 }
 
 func (m Message) String() string {
 	return fmt.Sprintf("Message[Type='%s']", m.Type)
 }
 
+// contentAs converts a decoded message Content (e.g. a map from JSON or msgpack) into the struct T
+func contentAs[T any](content any) (T, bool) {
+	var result T
+	data, err := json.Marshal(content)
+	if err != nil {
+		return result, false
+	}
+
+	if err = json.Unmarshal(data, &result); err != nil {
+		return result, false
+	}
+
+	return result, true
+}
+
 type ClientsTurnContent struct {
 	ClientId  int    // whose turn it is
 	Challenge string // what the challenge string is, e.g. "atr"
@@ -40,8 +73,26 @@ type ClientsTurnContent struct {
 	Now       int64  // current time according to the server
 }
 
+// TimeSyncContent is exchanged NTP-style: the client sends a TimeSyncReq with ClientSend, and the server fills in the rest.
+// From these (and when the response arrives) the client estimates both its clock offset from the server and the round trip time
+type TimeSyncContent struct {
+	ClientSend    int64 // when the client sent the request, according to the client's clock (milliseconds from unix epoch)
+	ServerReceive int64 // when the server received the request
+	ServerSend    int64 // when the server sent the response
+
+	// these are only set on requests, and let the server measure the round trip time from its side too
+	LastServerSend    int64 // ServerSend from the previous response the client received, or 0 if there wasn't one
+	LastClientReceive int64 // when the client received that previous response, according to the client's clock
+}
+
+type IdleWarningContent struct {
+	ClosesAt int64 // when the lobby will close if nothing happens, in milliseconds from unix epoch (UTC)
+	Now      int64 // current time according to the server
+}
+
 type TurnExpiredContent struct {
-	EliminatedClientId int      // id of the client who just went out
+	EliminatedClientId int      // id of the client who just ran out of time
+	Eliminated         bool     // whether they're out of the game (in scoring mode, running out of time only costs them the turn)
 	Suggestions        []string // some common words they could have answered with
 }
 
@@ -51,7 +102,10 @@ type ClientDetailsContent struct {
 	ClientId          int             // the id assigned to this client
 	ReconnectToken    string          // a token used to reconnect to the lobby as an existing player (during browser refresh/temp connection loss)
 	Status            gameStatus      // the status of the game (if a client connects mid-game or when the game is over, this is how they'll know)
+	HostId            int             // the id of the client who is the host
+	Settings          GameSettings    // how games in the lobby are played
 	Clients           []ClientContent // details of the existing clients in the lobby
+	SpectatorCount    int             // how many of the clients are spectating
 	CurrentTurnId     int             // the id of the client whose turn it is (or 0 if not applicable)
 	CurrentChallenge  string          // what the current challenge is, or "" if there isn't one
 	CurrentAnswerPrev string          // what the client whose turn it is currently has typed in
@@ -66,6 +120,12 @@ type ClientJoinedContent struct {
 	DisplayName string // what their name is
 	IconName    string // which icon they are using
 	Alive       bool   // whether they are alive or not
+	Spectator   bool   // whether they are only spectating
+}
+
+type SpectateChangeContent struct {
+	ClientId  int  // who is changing whether they spectate
+	Spectator bool // whether they are now spectating
 }
 
 type ClientNameChangeContent struct {
@@ -80,4 +140,6 @@ type ClientContent struct {
 	DisplayName string
 	IconName    string
 	Alive       bool
+	Spectator   bool
+	Score       int // their score in the current (or last) game, in scoring mode
 }
@@ -0,0 +1,149 @@
+package game
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBanned is returned when a player who was banned from a lobby tries to join it again
+var ErrBanned = errors.New("player is banned from this lobby")
+
+const bannedReason = "You have been banned from this lobby"
+
+// banList holds everything a banned player could rejoin with. It's checked while joining, outside the lobby goroutine,
+// so it has its own lock
+type banList struct {
+	mut      sync.Mutex
+	tokens   map[string]bool
+	ips      map[string]bool
+	bindings map[string]bool
+}
+
+// Bans is the serializable form of a banList, used in snapshots
+type Bans struct {
+	ReconnectTokens []string
+	Ips             []string
+	Bindings        []string
+}
+
+func newBanList() *banList {
+	return &banList{tokens: make(map[string]bool), ips: make(map[string]bool), bindings: make(map[string]bool)}
+}
+
+func (bans *banList) add(client *Client) {
+	bans.mut.Lock()
+	defer bans.mut.Unlock()
+
+	bans.tokens[client.getReconnectToken()] = true
+	if client.ip != "" {
+		bans.ips[client.ip] = true
+	}
+	if client.binding != "" {
+		bans.bindings[client.binding] = true
+	}
+}
+
+func (bans *banList) matches(request JoinRequest) bool {
+	bans.mut.Lock()
+	defer bans.mut.Unlock()
+
+	return (request.ReconnectToken != "" && bans.tokens[request.ReconnectToken]) ||
+		(request.IP != "" && bans.ips[request.IP]) ||
+		(request.Binding != "" && bans.bindings[request.Binding])
+}
+
+func (bans *banList) export() Bans {
+	bans.mut.Lock()
+	defer bans.mut.Unlock()
+
+	var exported Bans
+	for token := range bans.tokens {
+		exported.ReconnectTokens = append(exported.ReconnectTokens, token)
+	}
+	for ip := range bans.ips {
+		exported.Ips = append(exported.Ips, ip)
+	}
+	for binding := range bans.bindings {
+		exported.Bindings = append(exported.Bindings, binding)
+	}
+	return exported
+}
+
+func (bans *banList) restore(exported Bans) {
+	bans.mut.Lock()
+	defer bans.mut.Unlock()
+
+	for _, token := range exported.ReconnectTokens {
+		bans.tokens[token] = true
+	}
+	for _, ip := range exported.Ips {
+		bans.ips[ip] = true
+	}
+	for _, binding := range exported.Bindings {
+		bans.bindings[binding] = true
+	}
+}
+
+// IsBanned reports whether the player making the request has been banned from the lobby (by reconnect token, IP or binding)
+func (lobby *Lobby) IsBanned(request JoinRequest) bool {
+	return lobby.bans.matches(request)
+}
+
+// isHost reports whether the message came from the lobby's host, and if not, tells the sender that only the host may do that
+func (lobby *Lobby) isHost(message Message, action string) bool {
+	if message.From == lobby.hostId {
+		return true
+	}
+
+	if client, exists := lobby.clients[message.From]; exists {
+		client.send(Message{Type: Error, Content: ErrorContent{Code: "host_only", Message: "Only the host can " + action}})
+	}
+	return false
+}
+
+// assignHost makes the longest present client the host if there isn't one (e.g. the first client to join, or after the host leaves)
+func (lobby *Lobby) assignHost() {
+	if _, exists := lobby.clients[lobby.hostId]; exists || len(lobby.clients) == 0 {
+		return
+	}
+
+	newHost := lobby.getSortedClients()[0]
+	lobby.logger.Printf("%s is now the host", newHost)
+	lobby.hostId = newHost.id
+	lobby.BroadcastMessage(Message{Type: HostChanged, Content: newHost.id})
+}
+
+// getModerationTarget returns the client the host wants to kick or ban, or nil if the request isn't allowed
+func (lobby *Lobby) getModerationTarget(message Message, action string) *Client {
+	if !lobby.isHost(message, action) {
+		return nil
+	}
+
+	targetId, ok := contentAs[int](message.Content)
+	if !ok || targetId == lobby.hostId {
+		return nil
+	}
+
+	return lobby.clients[targetId]
+}
+
+func (lobby *Lobby) onKickClient(message Message) {
+	target := lobby.getModerationTarget(message, "kick players")
+	if target == nil {
+		return
+	}
+
+	lobby.logger.Printf("%s was kicked by the host", target)
+	lobby.closeClient(target, "You were kicked from the lobby by the host")
+}
+
+func (lobby *Lobby) onBanClient(message Message) {
+	target := lobby.getModerationTarget(message, "ban players")
+	if target == nil {
+		return
+	}
+
+	lobby.logger.Printf("%s was banned by the host", target)
+	lobby.bans.add(target)
+	lobby.closeClient(target, bannedReason)
+}
@@ -0,0 +1,116 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	maxRateLimitViolations    = 50              // how many rate limited messages a client may send before being disconnected
+	rateLimitViolationTimeout = 1 * time.Minute // how long without a violation before a client's violations are forgiven
+)
+
+// RateLimit is a token bucket: PerSecond tokens are added each second, up to Burst
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// MessageRateLimits limits how often each client may send each type of message. Types which aren't listed share a single
+// bucket limited by DefaultMessageRateLimit. Both can be overridden at startup (see SetMessageRateLimit)
+var (
+	MessageRateLimits = map[messageType]RateLimit{
+		AnswerPreview:    {PerSecond: 20, Burst: 40},
+		SubmitAnswer:     {PerSecond: 5, Burst: 10},
+		NameChange:       {PerSecond: 10, Burst: 30},
+		StartGame:        {PerSecond: 1, Burst: 3},
+		RestartGame:      {PerSecond: 1, Burst: 3},
+		ClientDetailsReq: {PerSecond: 1, Burst: 5},
+		TimeSyncReq:      {PerSecond: 2, Burst: 10},
+		KickClient:       {PerSecond: 1, Burst: 5},
+		BanClient:        {PerSecond: 1, Burst: 5},
+		SpectateChange:   {PerSecond: 1, Burst: 5},
+		ChangeSettings:   {PerSecond: 2, Burst: 10},
+	}
+	DefaultMessageRateLimit = RateLimit{PerSecond: 10, Burst: 20}
+)
+
+// ErrorContent accompanies an Error message
+type ErrorContent struct {
+	Code    string // machine readable, e.g. "rate_limited"
+	Message string // human readable
+}
+
+// SetMessageRateLimit overrides the rate limit for a type of message players send (e.g. "submit_answer"). It must be
+// called at startup, before any lobbies are created
+func SetMessageRateLimit(name string, limit RateLimit) error {
+	if _, exists := MessageRateLimits[messageType(name)]; !exists {
+		return fmt.Errorf("%q is not a message type players send", name)
+	}
+
+	if limit.PerSecond <= 0 || limit.Burst <= 0 {
+		return fmt.Errorf("rate limit for %q must allow at least some messages", name)
+	}
+
+	MessageRateLimits[messageType(name)] = limit
+	return nil
+}
+
+// messageLimiter enforces MessageRateLimits for one client. It's only used by the client's Read goroutine
+type messageLimiter struct {
+	limiters      map[messageType]*rate.Limiter
+	defaultLimit  *rate.Limiter // shared by every type not in MessageRateLimits, so made up types can't each get a fresh bucket
+	violations    int           // how many messages have been rate limited since the last time violations were forgiven
+	lastViolation time.Time     // when the last message was rate limited
+}
+
+func newMessageLimiter() *messageLimiter {
+	return &messageLimiter{
+		limiters:     make(map[messageType]*rate.Limiter),
+		defaultLimit: rate.NewLimiter(rate.Limit(DefaultMessageRateLimit.PerSecond), DefaultMessageRateLimit.Burst),
+	}
+}
+
+// allow reports whether the message may be processed, and records a violation if not
+func (l *messageLimiter) allow(message Message) bool {
+	limiter, exists := l.limiters[message.Type]
+	if !exists {
+		if limit, known := MessageRateLimits[message.Type]; known {
+			limiter = rate.NewLimiter(rate.Limit(limit.PerSecond), limit.Burst)
+			l.limiters[message.Type] = limiter
+		} else {
+			limiter = l.defaultLimit
+		}
+	}
+
+	if limiter.Allow() {
+		return true
+	}
+
+	if time.Since(l.lastViolation) > rateLimitViolationTimeout {
+		l.violations = 0
+	}
+	l.violations++
+	l.lastViolation = time.Now()
+	return false
+}
+
+// onRateLimited tells the client about their first violation in a while, and disconnects them if they keep going
+func (c *Client) onRateLimited(message Message) {
+	switch {
+	case c.limiter.violations == 1:
+		c.lobby.logger.Printf("%s is being rate limited for %s", c, message)
+		c.send(Message{Type: Error, Content: ErrorContent{
+			Code:    "rate_limited",
+			Message: "You're sending messages too quickly. Slow down!",
+		}})
+	case c.limiter.violations == maxRateLimitViolations:
+		c.lobby.logger.Printf("%s exceeded %d rate limit violations. Disconnecting them", c, maxRateLimitViolations)
+		c.send(Message{Type: Error, Content: ErrorContent{
+			Code:    "rate_limit_exceeded",
+			Message: "You were disconnected for sending too many messages",
+		}, closeAfter: true})
+	}
+}
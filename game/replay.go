@@ -0,0 +1,104 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+// Replay is the log of a single game: everything broadcast to the lobby from the moment it started until it finished
+type Replay struct {
+	Id        string          // identifies the replay, unique across every lobby
+	LobbyId   string          // the lobby the game was played in
+	Settings  GameSettings    // how the game was played
+	Seed      int64           // the seed the game's challenges were chosen with, so it can be played again exactly
+	LobbySeed int64           // the seed the lobby's default icons were shuffled with
+	Players   []ClientContent // everyone in the lobby when the game started
+	StartedAt int64           // in milliseconds from the unix epoch (UTC)
+	EndedAt   int64           // in milliseconds from the unix epoch (UTC), or 0 while the game is still going
+	Events    []ReplayEvent
+}
+
+// ReplayEvent is a message broadcast during a game, and when it was sent
+type ReplayEvent struct {
+	At      int64 // in milliseconds from the unix epoch (UTC)
+	Turn    int   // how many turns had started when the message was sent, so the game can be stepped through turn by turn
+	Message Message
+}
+
+// SaveReplay is called with the replay of every game once it finishes, if it's set.
+// It runs on its own goroutine, so it may be slow (e.g. writing to disk). It can be set at startup
+var SaveReplay func(replay Replay)
+
+// startReplay begins recording a new game
+func (lobby *Lobby) startReplay() {
+	if SaveReplay == nil {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	players := make([]ClientContent, 0, len(lobby.clients))
+	for _, c := range lobby.getSortedClients() {
+		players = append(players, ClientContent{Id: c.id, DisplayName: c.displayName, IconName: c.iconName, Alive: !c.spectator, Spectator: c.spectator})
+	}
+
+	lobby.replay = &Replay{
+		Id:        fmt.Sprintf("%s-%d", lobby.Id, now),
+		LobbyId:   lobby.Id,
+		Settings:  lobby.settings,
+		Seed:      lobby.seed,
+		LobbySeed: lobby.lobbySeed,
+		Players:   players,
+		StartedAt: now,
+	}
+}
+
+// recordReplayEvent adds a broadcast message to the replay of the game in progress, if there is one
+func (lobby *Lobby) recordReplayEvent(message Message) {
+	if lobby.replay == nil {
+		return
+	}
+
+	turn := 0
+	if events := lobby.replay.Events; len(events) > 0 {
+		turn = events[len(events)-1].Turn
+	}
+	if message.Type == ClientsTurn {
+		turn++
+	}
+
+	lobby.replay.Events = append(lobby.replay.Events, ReplayEvent{At: time.Now().UnixMilli(), Turn: turn, Message: message})
+}
+
+// copyReplay returns a copy of the replay of the game in progress which stays safe to read from other goroutines as the
+// game goes on (events are only ever appended), or nil if there isn't one
+func (lobby *Lobby) copyReplay() *Replay {
+	if lobby.replay == nil {
+		return nil
+	}
+
+	replay := *lobby.replay
+	return &replay
+}
+
+// getReplayId returns the id of the game in progress's replay, or "" if it isn't being recorded
+func (lobby *Lobby) getReplayId() string {
+	if lobby.replay == nil {
+		return ""
+	}
+	return lobby.replay.Id
+}
+
+// finishReplay hands the replay of the game that just finished to SaveReplay
+func (lobby *Lobby) finishReplay() {
+	replay := lobby.replay
+	if replay == nil {
+		return
+	}
+
+	lobby.replay = nil
+	if SaveReplay == nil {
+		return // replays were turned off since the game started (e.g. a restored lobby)
+	}
+	replay.EndedAt = time.Now().UnixMilli()
+	go SaveReplay(*replay)
+}
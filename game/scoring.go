@@ -0,0 +1,148 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jhshelnu/wordcraft/words"
+)
+
+type gameMode string
+
+const (
+	Elimination gameMode = "elimination" // players are out once they run out of time, and the last one left wins
+	Scoring     gameMode = "scoring"     // accepted answers earn points, and the highest scorer wins once the game ends
+	Daily       gameMode = "daily"       // a single player clears as many of the day's challenges as they can (only for daily challenge lobbies)
+)
+
+const (
+	MaxRounds      = 20   // the most rounds a scoring game may have
+	MaxTargetScore = 1000 // the highest target score a scoring game may have
+
+	uncommonAnswerBonus = 5 // points for an answer that isn't one of the common answers to the challenge
+	maxSpeedBonus       = 5 // points for answering instantly, falling to 0 for answering as time runs out
+)
+
+// GameSettings controls how games in a lobby are played. Only the host may change them, and only between games
+type GameSettings struct {
+	Mode        gameMode
+	Rounds      int   // in scoring mode, the game ends after this many rounds (or 0 for no limit)
+	TargetScore int   // in scoring mode, the game ends once a player reaches this score (or 0 for no target)
+	Seed        int64 // every game is played with the challenges produced by this seed (or 0 for a new seed each game)
+}
+
+var defaultGameSettings = GameSettings{Mode: Elimination, Rounds: 5}
+
+// validate reports what's wrong with the settings, if anything
+func (settings GameSettings) validate() (string, bool) {
+	switch {
+	case settings.Mode != Elimination && settings.Mode != Scoring:
+		return "Unknown game mode", false
+	case settings.Rounds < 0 || settings.Rounds > MaxRounds:
+		return fmt.Sprintf("Games can have at most %d rounds", MaxRounds), false
+	case settings.TargetScore < 0 || settings.TargetScore > MaxTargetScore:
+		return fmt.Sprintf("The target score can be at most %d", MaxTargetScore), false
+	case settings.Seed < 0 || settings.Seed > MaxSeed:
+		return fmt.Sprintf("The seed can be at most %d", int64(MaxSeed)), false
+	case settings.Mode == Scoring && settings.Rounds == 0 && settings.TargetScore == 0:
+		return "Scoring games need a number of rounds or a target score", false
+	default:
+		return "", true
+	}
+}
+
+type PointsAwardedContent struct {
+	ClientId int // who earned the points
+	Points   int // how many points the answer earned
+	Score    int // their score for the game so far
+}
+
+func (lobby *Lobby) onChangeSettings(message Message) {
+	if lobby.status == InProgress || !lobby.isHost(message, "change the game settings") {
+		return
+	}
+
+	if lobby.daily != "" {
+		lobby.clients[message.From].send(Message{Type: Error, Content: ErrorContent{Code: "invalid_settings", Message: "The daily challenge can't be changed"}})
+		return
+	}
+
+	settings, ok := contentAs[GameSettings](message.Content)
+	if !ok {
+		return
+	}
+
+	if problem, valid := settings.validate(); !valid {
+		lobby.clients[message.From].send(Message{Type: Error, Content: ErrorContent{Code: "invalid_settings", Message: problem}})
+		return
+	}
+
+	lobby.logger.Printf("Game settings changed to %+v", settings)
+	lobby.settings = settings
+	lobby.BroadcastMessage(Message{Type: ChangeSettings, Content: settings})
+}
+
+// getAnswerPoints returns how many points an accepted answer earns: a point per letter, a bonus if it isn't one of the
+// common answers to the challenge, and a bonus for answering quickly
+func (lobby *Lobby) getAnswerPoints(answer string, receivedAt time.Time) int {
+	points := len(answer)
+
+	if !words.IsCommonAnswer(lobby.currentChallenge, answer) {
+		points += uncommonAnswerBonus
+	}
+
+	if !receivedAt.IsZero() {
+		turnLength := float64(lobby.currentTurnEnd - lobby.currentTurnStart)
+		remaining := float64(lobby.currentTurnEnd - receivedAt.UnixMilli())
+		points += int(math.Round(maxSpeedBonus * max(min(remaining/turnLength, 1), 0)))
+	}
+
+	return points
+}
+
+// awardPoints adds the points for an accepted answer to the player's score, and ends the game if they've reached the target
+// returns whether the game has ended
+func (lobby *Lobby) awardPoints(client *Client, answer string, receivedAt time.Time) bool {
+	stats := lobby.getGameStats(client)
+	if stats == nil {
+		return false
+	}
+
+	points := lobby.getAnswerPoints(answer, receivedAt)
+	stats.Score += points
+	lobby.BroadcastMessage(Message{Type: PointsAwarded, Content: PointsAwardedContent{ClientId: client.id, Points: points, Score: stats.Score}})
+
+	if lobby.settings.TargetScore > 0 && stats.Score >= lobby.settings.TargetScore {
+		lobby.logger.Printf("%s reached the target score of %d", client, lobby.settings.TargetScore)
+		lobby.endGame()
+		return true
+	}
+	return false
+}
+
+// roundsComplete reports whether a scoring game has played all of its rounds
+func (lobby *Lobby) roundsComplete() bool {
+	return lobby.settings.Mode == Scoring && lobby.settings.Rounds > 0 && lobby.turnRounds > lobby.settings.Rounds
+}
+
+// getWinner returns the id and name of the game's winner: the last player left in elimination mode,
+// the highest scorer in scoring mode (ties go to whoever gave more answers, then whoever joined first),
+// or nobody in a daily challenge (0 and "")
+func (lobby *Lobby) getWinner() (int, string) {
+	if lobby.settings.Mode == Daily {
+		return 0, ""
+	}
+
+	if lobby.settings.Mode != Scoring {
+		return lobby.aliveClients[0].id, lobby.aliveClients[0].displayName
+	}
+
+	// players who left before the end can't win
+	for _, stats := range sortedStats(lobby.gameStats) {
+		if _, exists := lobby.clients[stats.ClientId]; exists {
+			return stats.ClientId, stats.DisplayName
+		}
+	}
+	return lobby.aliveClients[0].id, lobby.aliveClients[0].displayName
+}
@@ -0,0 +1,61 @@
+package game
+
+import (
+	"math/rand/v2"
+
+	"github.com/jhshelnu/wordcraft/icons"
+)
+
+// MaxSeed is the largest seed a game may be played with. Seeds are kept within the integers JavaScript can represent exactly
+const MaxSeed = 1<<53 - 1
+
+// newSeed picks a seed for a game which wasn't given one
+func newSeed() int64 {
+	return rand.Int64N(MaxSeed) + 1 // 0 is reserved for "no seed" in GameSettings
+}
+
+// shuffleIcons shuffles the lobby's default icons using lobbySeed. It has its own generator, so the shuffle can be
+// reproduced from lobbySeed alone, however many games have been seeded since
+func (lobby *Lobby) shuffleIcons() {
+	lobby.iconNames = icons.GetShuffledIconNames(rand.New(rand.NewPCG(uint64(lobby.lobbySeed), 0)))
+}
+
+// setSeed makes the game's random choices (e.g. challenges) follow the sequence produced by seed
+func (lobby *Lobby) setSeed(seed int64) {
+	lobby.seed = seed
+	lobby.rngSource = rand.NewPCG(uint64(seed), 0)
+	lobby.rng = rand.New(lobby.rngSource)
+}
+
+// seedGame seeds a new game, with the seed from the settings if the host chose one or a new seed otherwise
+func (lobby *Lobby) seedGame() {
+	seed := lobby.settings.Seed
+	if seed == 0 {
+		seed = newSeed()
+	}
+
+	lobby.logger.Printf("Game seed is %d", seed)
+	lobby.setSeed(seed)
+}
+
+// exportRng returns the state of the lobby's random number generator, so a restored lobby carries on the same sequence
+func (lobby *Lobby) exportRng() []byte {
+	state, err := lobby.rngSource.MarshalBinary()
+	if err != nil {
+		lobby.logger.Printf("Failed to export random number generator state: %v", err)
+		return nil
+	}
+	return state
+}
+
+// restoreRng restores the lobby's seed and random number generator from a snapshot, starting over from the seed if the state is missing
+func (lobby *Lobby) restoreRng(seed int64, state []byte) {
+	lobby.setSeed(seed)
+	if state == nil {
+		return
+	}
+
+	if err := lobby.rngSource.UnmarshalBinary(state); err != nil {
+		lobby.logger.Printf("Failed to restore random number generator state: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	restoredReconnectionTimeout = 60 * time.Second // how long players of a restored lobby get to reconnect after a restart
+	minRestoredTurnDuration     = 10 * time.Second // the least amount of time the current player gets to answer once their lobby is restored
+)
+
+// LobbySnapshot is everything needed to restore a Lobby after a server restart.
+// Players reconnect to a restored lobby using the reconnect tokens they already have
+type LobbySnapshot struct {
+	Id                string
+	TakenAt           int64            // when the snapshot was taken, in milliseconds from the unix epoch (UTC)
+	IconNames         []string         // the lobby's shuffled icon names
+	LobbySeed         int64            // the seed the icon names were shuffled with
+	Seed              int64            // the seed of the current (or last) game
+	RngState          []byte           // the state of the lobby's random number generator, part way through the seed's sequence
+	Public            bool             // whether the lobby is listed in the lobby browser
+	Daily             string           // the date of the daily challenge, if the lobby is for one
+	Clients           []ClientSnapshot // every client in the lobby
+	HostId            int
+	Bans              Bans
+	Access            AccessSnapshot
+	AliveClientIds    []int // ids of the clients who are not out, in turn order
+	Status            gameStatus
+	TurnIndex         int
+	TurnRounds        int
+	CurrentChallenge  string
+	CurrentAnswerPrev string
+	TurnRemaining     int64 // milliseconds left in the current turn when the snapshot was taken
+	WinnersName       string
+	Settings          GameSettings
+	GameStats         []PlayerStats
+	Tally             []PlayerStats
+	Replay            *Replay
+	LastClientId      int
+}
+
+type ClientSnapshot struct {
+	Id             int
+	ReconnectToken string
+	Binding        string
+	Ip             string
+	Spectator      bool
+	ProfileId      string
+	DisplayName    string
+	IconName       string
+}
+
+// ShutdownContent accompanies a Shutdown message
+type ShutdownContent struct {
+	Resumable bool // whether the lobby has been saved and will be restored, so the client should reconnect rather than leave
+}
+
+type snapshotRequest struct {
+	suspend bool               // whether to also tell the clients the lobby is being suspended for a restart
+	reply   chan LobbySnapshot // receives the snapshot
+}
+
+// Snapshot captures the current state of the lobby. Returns false if the lobby has already ended
+func (lobby *Lobby) Snapshot() (LobbySnapshot, bool) {
+	return lobby.requestSnapshot(false)
+}
+
+// Suspend captures the current state of the lobby and tells the clients to reconnect once the server has restarted.
+// Returns false if the lobby has already ended
+func (lobby *Lobby) Suspend() (LobbySnapshot, bool) {
+	return lobby.requestSnapshot(true)
+}
+
+func (lobby *Lobby) requestSnapshot(suspend bool) (LobbySnapshot, bool) {
+	request := snapshotRequest{suspend: suspend, reply: make(chan LobbySnapshot, 1)}
+	select {
+	case lobby.snapshotReq <- request:
+		return <-request.reply, true
+	case <-lobby.done:
+		return LobbySnapshot{}, false
+	}
+}
+
+func (lobby *Lobby) onSnapshotRequest(request snapshotRequest) {
+	request.reply <- lobby.buildSnapshot()
+
+	if request.suspend {
+		lobby.logger.Printf("Suspending lobby for server restart")
+		lobby.draining = true
+		lobby.shutdownSent = true
+		lobby.BroadcastMessage(Message{Type: Shutdown, Content: ShutdownContent{Resumable: true}})
+	}
+}
+
+func (lobby *Lobby) buildSnapshot() LobbySnapshot {
+	clients := make([]ClientSnapshot, 0, len(lobby.clients))
+	for _, c := range lobby.getSortedClients() {
+		clients = append(clients, ClientSnapshot{
+			Id:             c.id,
+			ReconnectToken: c.getReconnectToken(),
+			Binding:        c.binding,
+			Ip:             c.ip,
+			Spectator:      c.spectator,
+			ProfileId:      c.profileId,
+			DisplayName:    c.displayName,
+			IconName:       c.iconName,
+		})
+	}
+
+	aliveClientIds := make([]int, 0, len(lobby.aliveClients))
+	for _, c := range lobby.aliveClients {
+		aliveClientIds = append(aliveClientIds, c.id)
+	}
+
+	var turnRemaining int64
+	if lobby.status == InProgress {
+		turnRemaining = max(lobby.currentTurnEnd-time.Now().UnixMilli(), 0)
+	}
+
+	lobby.clientIdMutex.Lock()
+	lastClientId := lobby.lastClientId
+	lobby.clientIdMutex.Unlock()
+
+	return LobbySnapshot{
+		Id:                lobby.Id,
+		TakenAt:           time.Now().UnixMilli(),
+		IconNames:         lobby.iconNames,
+		LobbySeed:         lobby.lobbySeed,
+		Seed:              lobby.seed,
+		RngState:          lobby.exportRng(),
+		Public:            lobby.public,
+		Daily:             lobby.daily,
+		Clients:           clients,
+		HostId:            lobby.hostId,
+		Bans:              lobby.bans.export(),
+		Access:            lobby.access.export(),
+		AliveClientIds:    aliveClientIds,
+		Status:            lobby.status,
+		TurnIndex:         lobby.turnIndex,
+		TurnRounds:        lobby.turnRounds,
+		CurrentChallenge:  lobby.currentChallenge,
+		CurrentAnswerPrev: lobby.currentAnswerPrev,
+		TurnRemaining:     turnRemaining,
+		WinnersName:       lobby.winnersName,
+		Settings:          lobby.settings,
+		GameStats:         sortedStats(lobby.gameStats),
+		Tally:             sortedStats(lobby.tally),
+		Replay:            lobby.copyReplay(),
+		LastClientId:      lastClientId,
+	}
+}
+
+// RestoreLobby rebuilds a Lobby from a snapshot. Its clients start out disconnected, and are given
+// restoredReconnectionTimeout to reconnect before they are considered to have left
+func RestoreLobby(snapshot LobbySnapshot, lobbyEndChan chan string) (*Lobby, error) {
+	lobby := NewLobby(snapshot.Id, lobbyEndChan)
+	if snapshot.LobbySeed != 0 {
+		lobby.lobbySeed = snapshot.LobbySeed
+		lobby.shuffleIcons()
+	}
+	if len(snapshot.IconNames) > 0 {
+		lobby.iconNames = snapshot.IconNames // kept as they were, in case the icons on disk have changed since
+	}
+	if snapshot.Seed != 0 {
+		lobby.restoreRng(snapshot.Seed, snapshot.RngState)
+	}
+	lobby.public = snapshot.Public
+	lobby.daily = snapshot.Daily
+	lobby.status = snapshot.Status
+	lobby.turnIndex = snapshot.TurnIndex
+	lobby.turnRounds = snapshot.TurnRounds
+	lobby.currentChallenge = snapshot.CurrentChallenge
+	lobby.currentAnswerPrev = snapshot.CurrentAnswerPrev
+	lobby.winnersName = snapshot.WinnersName
+	if snapshot.Settings.Mode != "" {
+		lobby.settings = snapshot.Settings
+	}
+	lobby.gameStats = statsById(snapshot.GameStats)
+	lobby.tally = statsById(snapshot.Tally)
+	lobby.replay = snapshot.Replay
+	lobby.lastClientId = snapshot.LastClientId
+	lobby.hostId = snapshot.HostId
+	lobby.bans.restore(snapshot.Bans)
+	lobby.access.restore(snapshot.Access)
+
+	for _, clientSnapshot := range snapshot.Clients {
+		lobby.clients[clientSnapshot.Id] = &Client{
+			id:             clientSnapshot.Id,
+			reconnectToken: clientSnapshot.ReconnectToken,
+			tokenExpiresAt: time.Now().Add(restoredReconnectionTimeout),
+			binding:        clientSnapshot.Binding,
+			ip:             clientSnapshot.Ip,
+			spectator:      clientSnapshot.Spectator,
+			profileId:      clientSnapshot.ProfileId,
+			displayName:    clientSnapshot.DisplayName,
+			iconName:       clientSnapshot.IconName,
+			lobby:          lobby,
+			write:          make(chan Message),
+			disconnected:   make(chan bool),
+			limiter:        newMessageLimiter(),
+		}
+	}
+
+	for _, id := range snapshot.AliveClientIds {
+		client, exists := lobby.clients[id]
+		if !exists {
+			return nil, fmt.Errorf("alive client %d is not in the lobby", id)
+		}
+		lobby.aliveClients = append(lobby.aliveClients, client)
+	}
+
+	if lobby.status == InProgress {
+		if lobby.turnIndex < 0 || lobby.turnIndex >= len(lobby.aliveClients) {
+			return nil, fmt.Errorf("turn index %d is out of range for %d alive clients", lobby.turnIndex, len(lobby.aliveClients))
+		}
+
+		// the current player needs time to reconnect before they can answer
+		turnLimitDuration := max(time.Duration(snapshot.TurnRemaining)*time.Millisecond, minRestoredTurnDuration)
+		lobby.currentTurnEnd = time.Now().Add(turnLimitDuration).UnixMilli()
+		lobby.turnExpired = time.After(turnLimitDuration)
+	}
+
+	for _, client := range lobby.clients {
+		client.resume()
+	}
+
+	lobby.logger.Printf("Restored lobby with %d clients (status %s)", len(lobby.clients), lobby.status)
+	return lobby, nil
+}
@@ -0,0 +1,76 @@
+package game
+
+import "slices"
+
+// MaxPlayers and MaxSpectators limit how many players, and separately how many spectators, a lobby may have
+// (daily challenge lobbies only have room for one player)
+const (
+	MaxPlayers    = 10
+	MaxSpectators = 20
+)
+
+// getPlayers returns the clients who aren't spectating, sorted by id
+func (lobby *Lobby) getPlayers() []*Client {
+	var players []*Client
+	for _, c := range lobby.getSortedClients() {
+		if !c.spectator {
+			players = append(players, c)
+		}
+	}
+	return players
+}
+
+// getSpectatorCount returns how many clients in the lobby are spectating
+func (lobby *Lobby) getSpectatorCount() int {
+	count := 0
+	for _, c := range lobby.clients {
+		if c.spectator {
+			count++
+		}
+	}
+	return count
+}
+
+// checkCapacity reports whether there's no room in the lobby for the joining client, and if so the reason to give them
+func (lobby *Lobby) checkCapacity(joiningClient *Client) (string, bool) {
+	if joiningClient.spectator {
+		if lobby.getSpectatorCount() >= MaxSpectators {
+			return "Lobby has no room for more spectators", true
+		}
+	} else if len(lobby.getPlayers()) >= lobby.getMaxPlayers() {
+		return "Lobby is full", true
+	}
+	return "", false
+}
+
+// onSpectateChange lets a client switch between playing and spectating. Players can't stop playing while they are
+// still in a game, and spectators can only start playing if there's room (they join in once the next game starts)
+func (lobby *Lobby) onSpectateChange(message Message) {
+	spectate, ok := message.Content.(bool)
+	client := lobby.clients[message.From]
+	if !ok || client.spectator == spectate {
+		return
+	}
+
+	if spectate && lobby.status == InProgress && slices.Contains(lobby.aliveClients, client) {
+		client.send(Message{Type: Error, Content: ErrorContent{Code: "in_game", Message: "You can't spectate until you're out of the game"}})
+		return
+	}
+
+	if !spectate && len(lobby.getPlayers()) >= lobby.getMaxPlayers() {
+		client.send(Message{Type: Error, Content: ErrorContent{Code: "lobby_full", Message: "There's no room for another player"}})
+		return
+	}
+
+	client.spectator = spectate
+	if lobby.status != InProgress {
+		if spectate {
+			lobby.aliveClients = slices.DeleteFunc(lobby.aliveClients, func(c *Client) bool { return c == client })
+		} else {
+			lobby.aliveClients = append(lobby.aliveClients, client)
+		}
+	}
+
+	lobby.logger.Printf("%s is now spectating: %t", client, spectate)
+	lobby.BroadcastMessage(Message{Type: SpectateChange, Content: SpectateChangeContent{ClientId: client.id, Spectator: spectate}})
+}
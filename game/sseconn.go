@@ -0,0 +1,139 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sseKeepAliveInterval = 15 * time.Second // how often to send a comment on an idle event stream so proxies don't time it out
+
+// sseConn carries messages to the player over a Server-Sent Events stream, and from the player via HTTP POSTs.
+// It's a fallback for networks which block websocket upgrades
+type sseConn struct {
+	incoming  chan Message  // messages POSTed by the player, waiting to be read by the client
+	outgoing  chan Message  // messages waiting to be streamed to the player
+	done      chan struct{} // closed once the conn is finished, either by the server or by the player going away
+	doneErr   error         // why the conn finished, returned from ReadMessage/WriteMessage once done is closed
+	closeOnce sync.Once
+}
+
+func newSseConn() *sseConn {
+	return &sseConn{
+		incoming: make(chan Message),
+		outgoing: make(chan Message),
+		done:     make(chan struct{}),
+	}
+}
+
+func (t *sseConn) ReadMessage(message *Message) error {
+	select {
+	case *message = <-t.incoming:
+		return nil
+	case <-t.done:
+		return t.doneErr
+	}
+}
+
+func (t *sseConn) WriteMessage(message Message) error {
+	select {
+	case t.outgoing <- message:
+		return nil
+	case <-t.done:
+		return t.doneErr
+	}
+}
+
+func (t *sseConn) Close() error {
+	t.finish(errors.New("event stream closed"))
+	return nil
+}
+
+func (t *sseConn) finish(err error) {
+	t.closeOnce.Do(func() {
+		t.doneErr = err
+		close(t.done)
+	})
+}
+
+// ServeEventStream joins the player to the lobby (or reconnects them, given a valid ReconnectToken) and then streams
+// every message for them as a Server-Sent Event until either side goes away. Messages from the player are delivered
+// separately, via PostEventStreamMessage
+func ServeEventStream(w http.ResponseWriter, r *http.Request, lobby *Lobby, request JoinRequest) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("response writer does not support streaming")
+	}
+
+	conn := newSseConn()
+	if err := JoinToLobby(conn, lobby, request); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stops nginx-style proxies from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case message := <-conn.outgoing:
+			data, err := json.Marshal(message)
+			if err != nil {
+				lobby.logger.Printf("Failed to encode %s for event stream: %v", message, err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				conn.finish(fmt.Errorf("%w: %v", ErrConnLost, err))
+				return nil
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				conn.finish(fmt.Errorf("%w: %v", ErrConnLost, err))
+				return nil
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			// the player navigated away, refreshed, or lost their network. They may come back with their reconnectToken
+			conn.finish(fmt.Errorf("%w: %v", ErrConnLost, r.Context().Err()))
+			return nil
+		case <-conn.done:
+			return nil
+		}
+	}
+}
+
+// PostEventStreamMessage delivers a message from a player who is connected via ServeEventStream.
+// The player is identified by their ReconnectToken, which they learn from the ClientDetails message
+func PostEventStreamMessage(lobby *Lobby, request JoinRequest, message Message) error {
+	client := lobby.GetClientByReconnectToken(request.ReconnectToken)
+	if client == nil {
+		return errors.New("no client found for reconnect token")
+	}
+
+	if !client.matchesBinding(request.Binding) {
+		return errors.New("reconnect token is bound to a different browser")
+	}
+
+	client.connMut.Lock()
+	conn, ok := client.conn.(*sseConn)
+	client.connMut.Unlock()
+	if !ok {
+		return errors.New("client is not connected via an event stream")
+	}
+
+	select {
+	case conn.incoming <- message:
+		return nil
+	case <-conn.done:
+		return conn.doneErr
+	}
+}
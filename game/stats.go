@@ -0,0 +1,173 @@
+package game
+
+import (
+	"slices"
+	"time"
+)
+
+// PlayerStats is how a client performed, either in a single game or tallied across every game in the lobby
+type PlayerStats struct {
+	ClientId          int
+	ProfileId         string // the player's profile, if they have one
+	DisplayName       string
+	Answers           int    // how many answers were accepted
+	Rejections        int    // how many answers were rejected
+	ResponseTimeMs    int64  // total time taken to give the accepted answers, in milliseconds
+	AverageResponseMs int64  // average time taken to give an accepted answer, in milliseconds (0 if there weren't any)
+	LongestWord       string // the longest accepted answer
+	Score             int    // points earned in scoring mode
+	GamesPlayed       int    // how many games the client played in (only counts toward the running tally)
+	Wins              int    // how many games the client won (only counts toward the running tally)
+}
+
+// GameResult is how a player with a profile did in a finished game
+type GameResult struct {
+	ProfileId   string
+	Won         bool
+	LongestWord string // their longest accepted answer, or "" if they didn't give any
+	Daily       string // the date of the daily challenge, if the game was one
+	Cleared     int    // how many challenges they cleared (their score in a daily challenge)
+}
+
+// RecordResults is called with the results of the players who have profiles whenever a game finishes, if it's set.
+// It's called from the lobby goroutine, so anything slow (e.g. writing to a database) should be handed off to another goroutine.
+// It can be set at startup
+var RecordResults func(results []GameResult, finishedAt time.Time)
+
+// GameOverContent accompanies a GameOver message
+type GameOverContent struct {
+	WinnerId  int           // the id of the client who won
+	Mode      gameMode      // the mode the game was played in (scores are only meaningful in scoring mode)
+	GameStats []PlayerStats // how each player did in the game that just finished
+	Tally     []PlayerStats // how each player has done across every game played in the lobby
+	ReplayId  string        // the id of the game's replay, or "" if it wasn't recorded
+}
+
+// startGameStats begins recording stats for the players in a new game
+func (lobby *Lobby) startGameStats() {
+	lobby.gameStats = make(map[int]*PlayerStats, len(lobby.aliveClients))
+	for _, c := range lobby.aliveClients {
+		lobby.gameStats[c.id] = &PlayerStats{ClientId: c.id, ProfileId: c.profileId, DisplayName: c.displayName}
+	}
+}
+
+// getGameStats returns the stats of the client in the current game (nil if they aren't playing in it)
+func (lobby *Lobby) getGameStats(client *Client) *PlayerStats {
+	stats := lobby.gameStats[client.id]
+	if stats != nil {
+		stats.DisplayName = client.displayName
+	}
+	return stats
+}
+
+func (lobby *Lobby) recordRejection(client *Client) {
+	if stats := lobby.getGameStats(client); stats != nil {
+		stats.Rejections++
+	}
+}
+
+// recordAnswer records an accepted answer, and how long after the start of the turn it was received
+func (lobby *Lobby) recordAnswer(client *Client, answer string, receivedAt time.Time) {
+	stats := lobby.getGameStats(client)
+	if stats == nil {
+		return
+	}
+
+	stats.Answers++
+	if !receivedAt.IsZero() {
+		stats.ResponseTimeMs += max(receivedAt.UnixMilli()-lobby.currentTurnStart, 0)
+	}
+	if len(answer) > len(stats.LongestWord) {
+		stats.LongestWord = answer
+	}
+}
+
+// finishGameStats adds the stats of the game that just ended to the lobby's running tally, and returns both
+func (lobby *Lobby) finishGameStats(winnerId int) GameOverContent {
+	for id, stats := range lobby.gameStats {
+		if client, exists := lobby.clients[id]; exists {
+			stats.DisplayName = client.displayName
+		}
+
+		tally, exists := lobby.tally[id]
+		if !exists {
+			tally = &PlayerStats{ClientId: id, ProfileId: stats.ProfileId}
+			lobby.tally[id] = tally
+		}
+		tally.DisplayName = stats.DisplayName
+		tally.Answers += stats.Answers
+		tally.Rejections += stats.Rejections
+		tally.ResponseTimeMs += stats.ResponseTimeMs
+		tally.Score += stats.Score
+		tally.GamesPlayed++
+		if id == winnerId {
+			tally.Wins++
+		}
+		if len(stats.LongestWord) > len(tally.LongestWord) {
+			tally.LongestWord = stats.LongestWord
+		}
+	}
+
+	return GameOverContent{
+		WinnerId:  winnerId,
+		Mode:      lobby.settings.Mode,
+		GameStats: sortedStats(lobby.gameStats),
+		Tally:     sortedStats(lobby.tally),
+	}
+}
+
+// recordResults passes the results of the game that just ended to RecordResults, for the players who have profiles
+func (lobby *Lobby) recordResults(gameOver GameOverContent) {
+	if RecordResults == nil {
+		return
+	}
+
+	var results []GameResult
+	for _, stats := range gameOver.GameStats {
+		if stats.ProfileId != "" {
+			results = append(results, GameResult{
+				ProfileId:   stats.ProfileId,
+				Won:         stats.ClientId == gameOver.WinnerId,
+				LongestWord: stats.LongestWord,
+				Daily:       lobby.daily,
+				Cleared:     stats.Answers,
+			})
+		}
+	}
+
+	if len(results) > 0 {
+		RecordResults(results, time.Now())
+	}
+}
+
+// statsById indexes stats (e.g. from a snapshot) by client id
+func statsById(stats []PlayerStats) map[int]*PlayerStats {
+	indexed := make(map[int]*PlayerStats, len(stats))
+	for _, s := range stats {
+		indexed[s.ClientId] = &s
+	}
+	return indexed
+}
+
+// sortedStats copies the stats (filling in their averages) sorted by highest score, then most answers, then by client id
+func sortedStats(statsById map[int]*PlayerStats) []PlayerStats {
+	sorted := make([]PlayerStats, 0, len(statsById))
+	for _, stats := range statsById {
+		stats := *stats
+		if stats.Answers > 0 {
+			stats.AverageResponseMs = stats.ResponseTimeMs / int64(stats.Answers)
+		}
+		sorted = append(sorted, stats)
+	}
+
+	slices.SortFunc(sorted, func(s1 PlayerStats, s2 PlayerStats) int {
+		if s1.Score != s2.Score {
+			return s2.Score - s1.Score
+		}
+		if s1.Answers != s2.Answers {
+			return s2.Answers - s1.Answers
+		}
+		return s1.ClientId - s2.ClientId
+	})
+	return sorted
+}
@@ -0,0 +1,48 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+var recoverableWsErrors = []int{websocket.CloseNormalClosure, websocket.CloseGoingAway}
+
+// wsConn carries messages over a websocket connection, encoded with the codec negotiated at upgrade
+type wsConn struct {
+	ws    *websocket.Conn
+	codec Codec
+}
+
+func newWsConn(ws *websocket.Conn) *wsConn {
+	return &wsConn{ws: ws, codec: CodecForSubprotocol(ws.Subprotocol())}
+}
+
+func (t *wsConn) ReadMessage(message *Message) error {
+	_, data, err := t.ws.ReadMessage()
+	if err != nil {
+		if isRecoverableWsError(err) {
+			return fmt.Errorf("%w: %v", ErrConnLost, err)
+		}
+		return err
+	}
+
+	return t.codec.Decode(data, message)
+}
+
+func (t *wsConn) WriteMessage(message Message) error {
+	data, err := t.codec.Encode(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", message, err)
+	}
+
+	return t.ws.WriteMessage(t.codec.FrameType(), data)
+}
+
+func (t *wsConn) Close() error {
+	return t.ws.Close()
+}
+
+func isRecoverableWsError(err error) bool {
+	return websocket.IsCloseError(err, recoverableWsErrors...)
+}
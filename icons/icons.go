@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand/v2"
 	"os"
+	"slices"
 )
 
 const iconDirectory = "./static/icons"
@@ -23,11 +24,22 @@ func Init() error {
 	return nil
 }
 
-func GetShuffledIconNames() []string {
+// GetIconNames returns the names of every icon, sorted
+func GetIconNames() []string {
+	return slices.Sorted(slices.Values(iconNames))
+}
+
+// IsIconName reports whether name is the file name of one of the icons
+func IsIconName(name string) bool {
+	return slices.Contains(iconNames, name)
+}
+
+// GetShuffledIconNames returns the names of every icon, shuffled using rng
+func GetShuffledIconNames(rng *rand.Rand) []string {
 	iconNamesShuffled := make([]string, len(iconNames))
 	copy(iconNamesShuffled, iconNames)
 
-	rand.Shuffle(len(iconNamesShuffled), func(i, j int) {
+	rng.Shuffle(len(iconNamesShuffled), func(i, j int) {
 		iconNamesShuffled[i], iconNamesShuffled[j] = iconNamesShuffled[j], iconNamesShuffled[i]
 	})
 
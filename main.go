@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,57 +20,174 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/jhshelnu/wordcraft/game"
 	"github.com/jhshelnu/wordcraft/icons"
+	"github.com/jhshelnu/wordcraft/registry"
 	"github.com/jhshelnu/wordcraft/words"
 	cmap "github.com/orcaman/concurrent-map/v2"
 	"github.com/sethvargo/go-diceware/diceware"
 )
 
-const MaxLobbySize = 10
-
 var isProd = os.Getenv("PROD") != ""
 
 var logger = log.New(os.Stdout, "Application: ", log.Lshortfile|log.Lmsgprefix)
 
+var wsConf = loadWsConfig()
+
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	ReadBufferSize:    wsConf.readBufferSize,
+	WriteBufferSize:   wsConf.writeBufferSize,
+	WriteBufferPool:   &sync.Pool{}, // write buffers are only held while a message is being written, so idle clients don't each pin one
+	EnableCompression: wsConf.compression,
+	Subprotocols:      game.Subprotocols,
+	CheckOrigin:       isAllowedOrigin,
 }
 
 var lobbies = cmap.New[*game.Lobby]() // concurrent hash map, better optimized than sync.Map
+var draining atomic.Bool              // set once the server starts shutting down, after which no new lobbies or players are accepted
 var lobbyEndChan = make(chan string)
 
-func generateNewId() string {
+// generateNewId generates an id and claims it in the registry, so no other instance can create a lobby with the same id.
+// Private lobbies get ids from a much larger space, so they can't be found by guessing
+func generateNewId(private bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+
+	wordCount, wordList := 2, diceware.WordListEffSmall()
+	if private {
+		wordCount, wordList = 4, diceware.WordListEffLarge()
+	}
+
 	attempts := 0
 	for {
-		// start with 2 words, every 1 thousand attempts add another word
-		words, err := diceware.GenerateWithWordList(2+(attempts/1_000), diceware.WordListEffSmall())
+		// start with wordCount words, every 1 thousand attempts add another word
+		words, err := diceware.GenerateWithWordList(wordCount+(attempts/1_000), wordList)
 		if err != nil {
 			panic(err)
 		}
 
 		id := strings.Join(words, "-")
-		if !lobbies.Has(id) {
-			return id
+		claimed, err := lobbyRegistry.Register(ctx, id, instanceUrl)
+		if err != nil {
+			return "", err
+		}
+		if claimed {
+			return id, nil
 		}
 
 		attempts++
 	}
 }
 
+// createLobbyRequest is the (optional) body of a request to create a lobby. Setting a password or asking for invite
+// codes makes the lobby private
+type createLobbyRequest struct {
+	Password    string `json:"password"`
+	InviteCodes int    `json:"inviteCodes"` // how many single-use invite codes to create
+	Public      bool   `json:"public"`      // whether to list the lobby in the lobby browser (private lobbies can't be public)
+}
+
 func createLobby(c *gin.Context) {
-	lobby := game.NewLobby(generateNewId(), lobbyEndChan)
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Server is restarting. Please try again shortly."})
+		return
+	}
+
+	var request createLobbyRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Malformed request."})
+		return
+	}
+
+	if len(request.Password) > game.MaxPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Password must be at most %d characters.", game.MaxPassword)})
+		return
+	}
+
+	if request.InviteCodes < 0 || request.InviteCodes > game.MaxInviteCodes {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Lobbies can have at most %d invite codes.", game.MaxInviteCodes)})
+		return
+	}
+
+	private := request.Password != "" || request.InviteCodes > 0
+	if private && request.Public {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Private lobbies can't be listed publicly."})
+		return
+	}
+
+	lobbyId, err := generateNewId(private)
+	if err != nil {
+		logger.Printf("Failed to claim a new lobby id: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create lobby."})
+		return
+	}
+
+	lobby := game.NewLobby(lobbyId, lobbyEndChan)
+	if request.Password != "" {
+		if err := lobby.SetPassword(request.Password); err != nil {
+			logger.Printf("Failed to set lobby password: %v", err)
+			unregisterLobby(lobbyId)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create lobby."})
+			return
+		}
+	}
+	inviteCodes := lobby.CreateInviteCodes(request.InviteCodes)
+	lobby.SetPublic(request.Public)
+	startLobby(lobby)
+
+	if private {
+		c.JSON(http.StatusCreated, gin.H{"lobbyId": lobby.Id, "inviteCodes": inviteCodes})
+	} else {
+		c.JSON(http.StatusCreated, gin.H{"lobbyId": lobby.Id})
+	}
+}
+
+// creates a lobby for the player to play today's daily challenge in on their own
+func createDailyLobby(c *gin.Context) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Server is restarting. Please try again shortly."})
+		return
+	}
+
+	lobbyId, err := generateNewId(false)
+	if err != nil {
+		logger.Printf("Failed to claim a new lobby id: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create lobby."})
+		return
+	}
+
+	lobby := game.NewLobby(lobbyId, lobbyEndChan)
+	lobby.SetDaily(game.DailyDate(time.Now()))
+	startLobby(lobby)
+	c.JSON(http.StatusCreated, gin.H{"lobbyId": lobby.Id})
+}
+
+// startLobby starts a newly created lobby's goroutine and makes it reachable
+func startLobby(lobby *game.Lobby) {
 	go lobby.StartLobby()
 	lobbies.Set(lobby.Id, lobby)
-	c.JSON(http.StatusCreated, gin.H{"lobbyId": lobby.Id})
+}
+
+// reports whether a lobby exists (used by clients waiting for their lobby to be restored after a restart)
+func getLobby(c *gin.Context) {
+	lobbyId := c.Param("lobbyId")
+	if !lobbies.Has(lobbyId) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lobby not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lobbyId": lobbyId})
 }
 
 func handleIndex(c *gin.Context) {
-	c.HTML(http.StatusOK, "home.gohtml", gin.H{})
+	c.HTML(http.StatusOK, "home.gohtml", gin.H{"profilesEnabled": profilesEnabled(), "iconNames": icons.GetIconNames()})
 }
 
-// navigates the user to the page for a specific lobby
+// navigates the user to the page for a specific lobby. Private lobbies ask for a password first (which is POSTed back here),
+// unless the link includes an invite code
 func openLobby(c *gin.Context) {
 	lobbyId := c.Param("lobbyId")
+	password := c.PostForm("password")
+	inviteCode := c.Query("invite")
+	spectate := c.Query("spectate") == "true" || c.PostForm("spectate") == "true"
 
 	lobby, exists := lobbies.Get(lobbyId)
 	if !exists {
@@ -74,14 +197,48 @@ func openLobby(c *gin.Context) {
 		return
 	}
 
-	if lobby.GetClientCount() >= MaxLobbySize {
+	summary := lobby.Summary()
+	if spectate && summary.Spectators >= game.MaxSpectators {
+		c.HTML(http.StatusOK, "home.gohtml", gin.H{
+			"error": "Lobby has no room for more spectators",
+		})
+		return
+	}
+
+	if !spectate && summary.Players >= summary.MaxPlayers {
 		c.HTML(http.StatusOK, "home.gohtml", gin.H{
 			"error": "Lobby is full",
 		})
 		return
 	}
 
-	c.HTML(http.StatusOK, "lobby.gohtml", gin.H{"lobbyId": lobbyId, "isProd": isProd})
+	// the reconnect token is only checked once they join, since it isn't sent with the page request
+	if lobby.IsBanned(joinRequest(c, "")) {
+		c.HTML(http.StatusOK, "home.gohtml", gin.H{
+			"error": "You have been banned from this lobby",
+		})
+		return
+	}
+
+	// the password or invite code is swapped for a short-lived access token, so it doesn't end up in the websocket or event stream URL
+	accessToken, err := lobby.GrantAccess(password, inviteCode)
+	if err != nil {
+		h := gin.H{"passwordLobbyId": lobbyId, "spectate": spectate}
+		if password != "" {
+			h["error"] = "Incorrect password"
+		} else if inviteCode != "" {
+			h["error"] = "This invite isn't valid"
+		}
+		c.HTML(http.StatusOK, "home.gohtml", h)
+		return
+	}
+
+	ensureBindingCookie(c)
+	c.HTML(http.StatusOK, "lobby.gohtml", gin.H{"lobbyId": lobbyId, "accessToken": accessToken, "spectate": spectate, "isProd": isProd})
+}
+
+func hasInviteCode(c *gin.Context) bool {
+	return c.Query("invite") != ""
 }
 
 // once on the page for a specific lobby, the browser sends a request here to establish a WebSocket connection
@@ -96,6 +253,11 @@ func joinLobby(c *gin.Context) {
 		return
 	}
 
+	if !canJoin(lobby, reconnectToken) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Server is restarting. Please try again shortly."})
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade ws connection: %v\n", err)
@@ -105,17 +267,84 @@ func joinLobby(c *gin.Context) {
 		return
 	}
 
-	err = game.JoinConnToLobby(conn, lobby, reconnectToken)
+	if wsConf.compression {
+		// only takes effect if the client negotiated permessage-deflate
+		_ = conn.SetCompressionLevel(wsConf.compressionLevel)
+	}
+
+	request := joinRequest(c, reconnectToken)
+	request.Profile = joinProfile(c)
+	err = game.JoinConnToLobby(conn, lobby, request)
 	if err != nil {
 		fmt.Printf("Client failed to join lobby: %v\n", err)
 		_ = conn.Close()
 	}
 }
 
+// fallback for networks that block websocket upgrades. The browser opens an event stream here to receive messages,
+// and joins the lobby exactly like it would through joinLobby
+func streamLobby(c *gin.Context) {
+	lobbyId := c.Param("lobbyId")
+	reconnectToken := c.Query("reconnectToken")
+
+	lobby, exists := lobbies.Get(lobbyId)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lobby not found"})
+		return
+	}
+
+	if !canJoin(lobby, reconnectToken) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Server is restarting. Please try again shortly."})
+		return
+	}
+
+	request := joinRequest(c, reconnectToken)
+	request.Profile = joinProfile(c)
+	err := game.ServeEventStream(c.Writer, c.Request, lobby, request)
+	if err != nil {
+		fmt.Printf("Client failed to join lobby via event stream: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to join lobby."})
+	}
+}
+
+// when connected via streamLobby, the browser sends its messages here instead of over a websocket
+func postLobbyMessage(c *gin.Context) {
+	lobbyId := c.Param("lobbyId")
+	reconnectToken := c.GetHeader("X-Reconnect-Token")
+
+	lobby, exists := lobbies.Get(lobbyId)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lobby not found"})
+		return
+	}
+
+	var message game.Message
+	if err := c.ShouldBindJSON(&message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Malformed message"})
+		return
+	}
+
+	if err := game.PostEventStreamMessage(lobby, joinRequest(c, reconnectToken), message); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// canJoin reports whether a player may join the lobby. While draining, only existing players may reconnect
+func canJoin(lobby *game.Lobby, reconnectToken string) bool {
+	return !draining.Load() || lobby.GetClientByReconnectToken(reconnectToken) != nil
+}
+
 func handleEndedLobbies() {
 	for {
 		endedLobbyId := <-lobbyEndChan
 		lobbies.Remove(endedLobbyId)
+		if !suspendedLobbies.Has(endedLobbyId) {
+			removeSnapshot(endedLobbyId) // a lobby that ended has nothing to restore, even if it ended while draining
+		}
+		unregisterLobby(endedLobbyId)
 	}
 }
 
@@ -128,31 +357,100 @@ func main() {
 		log.Fatal(err)
 	}
 
+	game.AnswerGraceWindow = time.Duration(getEnvInt("ANSWER_GRACE_MS", 500)) * time.Millisecond
+	game.EmptyLobbyTimeout = time.Duration(getEnvInt("EMPTY_LOBBY_TIMEOUT_MINUTES", 5)) * time.Minute
+	game.IdleLobbyTimeout = time.Duration(getEnvInt("IDLE_LOBBY_TIMEOUT_MINUTES", 15)) * time.Minute
+	loadMessageRateLimits()
+
+	if err := openProfileStore(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := startSavingReplays(); err != nil {
+		log.Fatal(err)
+	}
+
+	var err error
+	if lobbyRegistry, err = newRegistry(); err != nil {
+		log.Fatal(err)
+	}
+	go renewLobbyClaims(registry.DefaultTTL / 3)
+
 	go handleEndedLobbies()
 
+	if snapshotsEnabled() {
+		if err := restoreLobbies(); err != nil {
+			log.Fatal(err)
+		}
+		go snapshotLobbies(time.Duration(getEnvInt("SNAPSHOT_INTERVAL_SECONDS", 30)) * time.Second)
+	}
+
 	if isProd {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	server := gin.New()
 
+	// bans and rate limits are keyed by the client's IP, so X-Forwarded-For is only believed from known proxies
+	if err := server.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal(err)
+	}
+
 	// Static assets
 	server.Static("/static", "./static")
 
+	createLobbyLimit := rateLimitByIp(newIpRateLimiter(getEnvInt("LOBBY_CREATE_PER_MINUTE", 10), getEnvInt("LOBBY_CREATE_BURST", 5)))
+	quickPlayLimit := rateLimitByIp(newIpRateLimiter(getEnvInt("QUICKPLAY_PER_MINUTE", 20), getEnvInt("QUICKPLAY_BURST", 5)))
+	dailyLimit := rateLimitByIp(newIpRateLimiter(getEnvInt("DAILY_CREATE_PER_MINUTE", 10), getEnvInt("DAILY_CREATE_BURST", 5)))
+	profileCreateLimit := rateLimitByIp(newIpRateLimiter(getEnvInt("PROFILE_CREATE_PER_MINUTE", 5), getEnvInt("PROFILE_CREATE_BURST", 3)))
+	joinLobbyLimit := rateLimitByIp(newIpRateLimiter(getEnvInt("LOBBY_JOIN_PER_MINUTE", 60), getEnvInt("LOBBY_JOIN_BURST", 20)))
+	passwordLimiter := newIpRateLimiter(getEnvInt("LOBBY_PASSWORD_PER_MINUTE", 10), getEnvInt("LOBBY_PASSWORD_BURST", 5))
+
 	// API
 	apiGroup := server.Group("/api")
-	apiGroup.POST("/lobby", createLobby)
+	apiGroup.POST("/lobby", requireAllowedOrigin, createLobbyLimit, createLobby)
+	apiGroup.GET("/lobby/:lobbyId", routeToOwner, getLobby)
+	apiGroup.GET("/lobbies", listLobbies)
+	apiGroup.POST("/quickplay", requireAllowedOrigin, quickPlayLimit, quickPlay)
+	apiGroup.POST("/daily", requireAllowedOrigin, dailyLimit, createDailyLobby)
+	if replaysEnabled() {
+		apiGroup.GET("/replays/:replayId", getReplay)
+	}
+	if profilesEnabled() {
+		apiGroup.POST("/profile", requireAllowedOrigin, profileCreateLimit, createProfile)
+		apiGroup.GET("/profile", getOwnProfile)
+		apiGroup.PUT("/profile", requireAllowedOrigin, updateProfile)
+		apiGroup.GET("/profiles/:profileId", getProfile)
+		apiGroup.GET("/leaderboard", getLeaderboard)
+		apiGroup.GET("/leaderboard/weekly", getWeeklyLeaderboard)
+		apiGroup.GET("/leaderboard/daily", getDailyLeaderboard)
+	}
 
 	// HTML
 	server.LoadHTMLGlob("templates/*.gohtml")
 	server.GET("/", handleIndex)
-	server.GET("/lobby/:lobbyId", openLobby)
+	// passwords and invite codes share a limit, so they can't be guessed quickly
+	server.GET("/lobby/:lobbyId", rateLimitByIpWhen(passwordLimiter, hasInviteCode), routeToOwner, openLobby)
+	server.POST("/lobby/:lobbyId", requireAllowedOrigin, rateLimitByIp(passwordLimiter), routeToOwner, openLobby)
 
 	// WebSocket
-	server.GET("/ws/:lobbyId", joinLobby)
+	server.GET("/ws/:lobbyId", joinLobbyLimit, routeToOwner, joinLobby)
+
+	// Server-Sent Events (fallback for when websockets are blocked)
+	server.GET("/sse/:lobbyId", requireAllowedOrigin, joinLobbyLimit, routeToOwner, streamLobby)
+	server.POST("/sse/:lobbyId", requireAllowedOrigin, routeToOwner, postLobbyMessage)
+
+	// long-lived requests (event streams) are derived from this context, so they end when the server shuts down
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Addr:        ":" + getEnv("PORT", "8080"),
+		Handler:     server,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	httpServer.RegisterOnShutdown(cancelBaseCtx)
 
 	go func() {
-		err := server.Run()
-		if err != nil {
+		err := httpServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Failed to start application server: %v", err)
 		}
 	}()
@@ -161,15 +459,5 @@ func main() {
 	signal.Notify(shutdownRequested, syscall.SIGTERM, syscall.SIGINT)
 
 	<-shutdownRequested
-	if lobbies.Count() == 0 {
-		logger.Printf("Received request to shutdown. No lobbies in progress. Goodbye.")
-		os.Exit(0)
-	}
-
-	logger.Printf("Received request to shutdown. Notifying %d lobbies first. Goodbye.", lobbies.Count())
-	lobbies.IterCb(func(_ string, lobby *game.Lobby) {
-		lobby.BroadcastShutdown()
-	})
-	time.Sleep(8 * time.Second) // give the clients enough time to see the shutdown message and be redirected to the home screen
-	os.Exit(0)
+	shutdown(httpServer)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowedOrigins are the origins (e.g. https://wordcraft.ing) which may create and join lobbies, from the comma separated
+// ALLOWED_ORIGINS. When empty, only requests from the same origin as the server itself are allowed
+var allowedOrigins = parseAllowedOrigins(getEnv("ALLOWED_ORIGINS", ""))
+
+func parseAllowedOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, strings.ToLower(origin))
+		}
+	}
+	return origins
+}
+
+// isAllowedOrigin reports whether the request came from an allowed origin. Requests without an Origin (or Referer)
+// header are allowed, since they don't come from a browser and so can't be forged by another site
+func isAllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = originOf(r.Header.Get("Referer"))
+		if origin == "" {
+			return true
+		}
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host == "" {
+		return false
+	}
+
+	if len(allowedOrigins) == 0 {
+		return strings.EqualFold(originUrl.Host, r.Host)
+	}
+
+	normalized := strings.ToLower(originUrl.Scheme + "://" + originUrl.Host)
+	for _, allowed := range allowedOrigins {
+		if normalized == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// originOf returns the scheme and host of a URL, or "" if it isn't a valid absolute URL
+func originOf(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// requireAllowedOrigin rejects requests from origins which aren't allowed, so other sites can't act on a player's behalf
+func requireAllowedOrigin(c *gin.Context) {
+	if !isAllowedOrigin(c.Request) {
+		logger.Printf("Rejected %s %s from disallowed origin %q", c.Request.Method, c.Request.URL.Path, c.GetHeader("Origin"))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": "origin_not_allowed", "message": "Origin not allowed"})
+		return
+	}
+
+	c.Next()
+}
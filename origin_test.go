@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jhshelnu/wordcraft/game"
+	"github.com/jhshelnu/wordcraft/icons"
+)
+
+func TestIsAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string // ALLOWED_ORIGINS
+		origin  string
+		referer string
+		want    bool
+	}{
+		{name: "same origin", origin: "http://wordcraft.test", want: true},
+		{name: "same origin, different case", origin: "http://WordCraft.test", want: true},
+		{name: "same origin from referer", referer: "http://wordcraft.test/lobby/abc", want: true},
+		{name: "missing origin", want: true},
+		{name: "foreign origin", origin: "https://evil.test", want: false},
+		{name: "foreign referer", referer: "https://evil.test/page", want: false},
+		{name: "malformed origin", origin: "::", want: false},
+		{name: "null origin", origin: "null", want: false},
+		{name: "allowed origin", allowed: "https://wordcraft.ing, https://www.wordcraft.ing/", origin: "https://www.wordcraft.ing", want: true},
+		{name: "allowed list excludes same origin", allowed: "https://wordcraft.ing", origin: "http://wordcraft.test", want: false},
+		{name: "allowed list checks scheme", allowed: "https://wordcraft.ing", origin: "http://wordcraft.ing", want: false},
+		{name: "allowed list, foreign origin", allowed: "https://wordcraft.ing", origin: "https://evil.test", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withAllowedOrigins(t, test.allowed)
+
+			r := httptest.NewRequest(http.MethodPost, "http://wordcraft.test/api/lobby", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.referer != "" {
+				r.Header.Set("Referer", test.referer)
+			}
+
+			if got := isAllowedOrigin(r); got != test.want {
+				t.Errorf("isAllowedOrigin() with Origin %q and Referer %q = %t, want %t", test.origin, test.referer, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequireAllowedOrigin(t *testing.T) {
+	withAllowedOrigins(t, "")
+	gin.SetMode(gin.TestMode)
+
+	server := gin.New()
+	server.POST("/api/lobby", requireAllowedOrigin, func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{name: "same origin", origin: "http://wordcraft.test", want: http.StatusCreated},
+		{name: "foreign origin", origin: "https://evil.test", want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://wordcraft.test/api/lobby", nil)
+			r.Header.Set("Origin", test.origin)
+			w := httptest.NewRecorder()
+
+			server.ServeHTTP(w, r)
+			if w.Code != test.want {
+				t.Errorf("POST with Origin %q responded %d, want %d", test.origin, w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestWebsocketUpgradeChecksOrigin(t *testing.T) {
+	withAllowedOrigins(t, "")
+	if err := icons.Init(); err != nil { // joining gives the client an icon
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+
+	lobby := game.NewLobby("origin-test", make(chan string, 1))
+	go lobby.StartLobby()
+	lobbies.Set(lobby.Id, lobby)
+	t.Cleanup(func() { lobbies.Remove(lobby.Id) })
+
+	server := gin.New()
+	server.GET("/ws/:lobbyId", joinLobby)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	tests := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{name: "same origin", origin: httpServer.URL, want: http.StatusSwitchingProtocols},
+		{name: "foreign origin", origin: "https://evil.test", want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{"Origin": {test.origin}}
+			conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/ws/"+lobby.Id, header)
+			if conn != nil {
+				t.Cleanup(func() { _ = conn.Close() })
+			}
+			if response == nil {
+				t.Fatalf("handshake with Origin %q failed without a response: %v", test.origin, err)
+			}
+			if response.StatusCode != test.want {
+				t.Errorf("handshake with Origin %q responded %d, want %d", test.origin, response.StatusCode, test.want)
+			}
+		})
+	}
+}
+
+// withAllowedOrigins sets allowedOrigins as if ALLOWED_ORIGINS were value, for the rest of the test
+func withAllowedOrigins(t *testing.T, value string) {
+	previous := allowedOrigins
+	allowedOrigins = parseAllowedOrigins(value)
+	t.Cleanup(func() { allowedOrigins = previous })
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhshelnu/wordcraft/game"
+	cmap "github.com/orcaman/concurrent-map/v2"
+)
+
+const maxSnapshotAge = 10 * time.Minute // snapshots older than this are discarded at startup rather than restored
+
+// snapshotDir is where lobby snapshots are written, or "" if snapshots are disabled
+var snapshotDir = getEnv("SNAPSHOT_DIR", "./snapshots")
+
+// suspendedLobbies are the lobbies suspended by shutdown, whose snapshots are kept when they end so they're restored on startup
+var suspendedLobbies = cmap.New[bool]()
+
+func snapshotsEnabled() bool {
+	return snapshotDir != ""
+}
+
+func snapshotPath(lobbyId string) string {
+	return filepath.Join(snapshotDir, lobbyId+".json")
+}
+
+// writeSnapshot writes the snapshot to disk, replacing any previous snapshot of the same lobby atomically
+func writeSnapshot(snapshot game.LobbySnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot of lobby %s: %w", snapshot.Id, err)
+	}
+
+	tmpPath := snapshotPath(snapshot.Id) + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot of lobby %s: %w", snapshot.Id, err)
+	}
+
+	return os.Rename(tmpPath, snapshotPath(snapshot.Id))
+}
+
+func removeSnapshot(lobbyId string) {
+	if !snapshotsEnabled() {
+		return
+	}
+
+	if err := os.Remove(snapshotPath(lobbyId)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Printf("Failed to remove snapshot of lobby %s: %v", lobbyId, err)
+	}
+}
+
+// snapshotLobbies periodically writes a snapshot of every lobby, so they can be recovered even if the server dies unexpectedly
+func snapshotLobbies(interval time.Duration) {
+	for range time.Tick(interval) {
+		if draining.Load() {
+			return // shutdown takes its own snapshots
+		}
+
+		var written []string
+		lobbies.IterCb(func(_ string, lobby *game.Lobby) {
+			snapshot, ok := lobby.Snapshot()
+			if !ok {
+				return
+			}
+
+			if err := writeSnapshot(snapshot); err != nil {
+				logger.Printf("%v", err)
+				return
+			}
+			written = append(written, snapshot.Id)
+		})
+
+		// lobbies which ended while their snapshot was being written have already tried removing it
+		for _, lobbyId := range written {
+			if !lobbies.Has(lobbyId) && !suspendedLobbies.Has(lobbyId) {
+				removeSnapshot(lobbyId)
+			}
+		}
+	}
+}
+
+// suspendLobbies snapshots every remaining lobby and tells its clients to reconnect once the server is back
+func suspendLobbies() {
+	suspended := 0
+	lobbies.IterCb(func(_ string, lobby *game.Lobby) {
+		// marked first, since the lobby ends as soon as its clients have been told to reconnect
+		suspendedLobbies.Set(lobby.Id, true)
+		snapshot, ok := lobby.Suspend()
+		if !ok {
+			// it ended normally before it could be suspended
+			suspendedLobbies.Remove(lobby.Id)
+			removeSnapshot(lobby.Id)
+			return
+		}
+
+		if err := writeSnapshot(snapshot); err != nil {
+			logger.Printf("%v", err)
+			return
+		}
+		suspended++
+	})
+
+	logger.Printf("Saved %d lobbies to %s", suspended, snapshotDir)
+}
+
+// restoreLobbies restores every lobby with a recent enough snapshot, so their players can reconnect
+func restoreLobbies() error {
+	if err := os.MkdirAll(snapshotDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory %s: %w", snapshotDir, err)
+	}
+
+	dirEntries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot directory %s: %w", snapshotDir, err)
+	}
+
+	for _, file := range dirEntries {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(snapshotDir, file.Name())
+		if err = restoreLobby(path); err != nil {
+			logger.Printf("Not restoring %s: %v", path, err)
+		}
+		_ = os.Remove(path) // the restored lobby will write a fresh snapshot
+	}
+
+	return nil
+}
+
+func restoreLobby(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snapshot game.LobbySnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	if age := time.Since(time.UnixMilli(snapshot.TakenAt)); age > maxSnapshotAge {
+		return fmt.Errorf("snapshot is too old (%s)", age.Round(time.Second))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err = lobbyRegistry.Renew(ctx, snapshot.Id, instanceUrl); err != nil {
+		return fmt.Errorf("failed to reclaim lobby: %w", err)
+	}
+
+	lobby, err := game.RestoreLobby(snapshot, lobbyEndChan)
+	if err != nil {
+		unregisterLobby(snapshot.Id)
+		return err
+	}
+
+	go lobby.StartLobby()
+	lobbies.Set(lobby.Id, lobby)
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/game"
+	"github.com/jhshelnu/wordcraft/icons"
+	"github.com/jhshelnu/wordcraft/profiles"
+)
+
+const (
+	profileCookieName     = "wordcraft_profile"
+	profileCookieMaxAge   = 400 * 24 * 60 * 60 // the longest browsers will keep a cookie, in seconds
+	defaultLeaderboardLen = 10
+	maxLeaderboardLen     = 100
+)
+
+// profileDbPath is where player profiles are stored, or "" if profiles are disabled
+var profileDbPath = getEnv("PROFILE_DB_PATH", "./profiles.db")
+
+var profileStore *profiles.Store // nil if profiles are disabled
+
+var pendingResults sync.WaitGroup // game results still being written to the profile store
+
+func profilesEnabled() bool {
+	return profileStore != nil
+}
+
+// openProfileStore opens the profile database, and starts recording the results of finished games to it
+func openProfileStore() error {
+	if profileDbPath == "" {
+		return nil
+	}
+
+	store, err := profiles.Open(profileDbPath)
+	if err != nil {
+		return err
+	}
+
+	profileStore = store
+	game.RecordResults = func(results []game.GameResult, finishedAt time.Time) {
+		// added before handing off, so closeProfileStore can't miss results which haven't started being written yet
+		pendingResults.Add(1)
+		go func() {
+			defer pendingResults.Done()
+			recordResults(results, finishedAt)
+		}()
+	}
+	return nil
+}
+
+// closeProfileStore waits for any game results still being recorded, then closes the profile database
+func closeProfileStore() {
+	if !profilesEnabled() {
+		return
+	}
+
+	pendingResults.Wait()
+	if err := profileStore.Close(); err != nil {
+		logger.Printf("Failed to close profile database: %v", err)
+	}
+}
+
+// recordResults records the results of a finished game to the players' profiles. Daily challenges are kept apart,
+// on their own leaderboards, so they don't count toward the players' games played or wins
+func recordResults(results []game.GameResult, finishedAt time.Time) {
+	profileResults := make([]profiles.GameResult, 0, len(results))
+	for _, result := range results {
+		if result.Daily != "" {
+			recordDaily(result, finishedAt)
+			continue
+		}
+		profileResults = append(profileResults, profiles.GameResult{ProfileId: result.ProfileId, Won: result.Won, LongestWord: result.LongestWord})
+	}
+
+	if len(profileResults) == 0 {
+		return
+	}
+
+	if err := profileStore.RecordGame(profileResults, finishedAt); err != nil {
+		logger.Printf("Failed to record game results: %v", err)
+	}
+}
+
+func recordDaily(result game.GameResult, finishedAt time.Time) {
+	recorded, err := profileStore.RecordDaily(result.ProfileId, result.Daily, result.Cleared, finishedAt)
+	if err != nil && !errors.Is(err, profiles.ErrNotFound) {
+		logger.Printf("Failed to record daily challenge result: %v", err)
+	} else if err == nil && !recorded {
+		logger.Printf("Not recording daily challenge result for profile %s, since they've already played the %s challenge", result.ProfileId, result.Daily)
+	}
+}
+
+// currentProfile returns the profile of the player making the request, or false if they don't have one
+func currentProfile(c *gin.Context) (profiles.Profile, bool) {
+	if !profilesEnabled() {
+		return profiles.Profile{}, false
+	}
+
+	token, err := c.Cookie(profileCookieName)
+	if err != nil || token == "" {
+		return profiles.Profile{}, false
+	}
+
+	profile, err := profileStore.Authenticate(token)
+	if err != nil {
+		if !errors.Is(err, profiles.ErrNotFound) {
+			logger.Printf("Failed to look up profile: %v", err)
+		}
+		return profiles.Profile{}, false
+	}
+
+	return profile, true
+}
+
+// joinProfile returns the profile the player making the request joins lobbies with, or nil if they don't have one
+func joinProfile(c *gin.Context) *game.JoinProfile {
+	profile, exists := currentProfile(c)
+	if !exists {
+		return nil
+	}
+
+	return &game.JoinProfile{Id: profile.Id, DisplayName: profile.DisplayName, IconName: profile.IconName}
+}
+
+// profileRequest is the body of a request to create or update a profile
+type profileRequest struct {
+	DisplayName string `json:"displayName"`
+	IconName    string `json:"iconName"`
+}
+
+// bindProfileRequest reads and validates the profile request, responding with an error (and returning false) if it isn't valid
+func bindProfileRequest(c *gin.Context) (profileRequest, bool) {
+	var request profileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Malformed request."})
+		return request, false
+	}
+
+	if request.DisplayName == "" || len(request.DisplayName) > game.MaxDisplayName {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Display name must be between 1 and %d characters.", game.MaxDisplayName)})
+		return request, false
+	}
+
+	if !icons.IsIconName(request.IconName) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown icon."})
+		return request, false
+	}
+
+	return request, true
+}
+
+// creates a profile for the player, and gives their browser the cookie which identifies them as its owner
+func createProfile(c *gin.Context) {
+	request, valid := bindProfileRequest(c)
+	if !valid {
+		return
+	}
+
+	profile, token, err := profileStore.Create(request.DisplayName, request.IconName)
+	if err != nil {
+		logger.Printf("Failed to create profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create profile."})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(profileCookieName, token, profileCookieMaxAge, "/", "", isProd, true)
+	c.JSON(http.StatusCreated, gin.H{"profile": profile})
+}
+
+// returns the profile of the player making the request
+func getOwnProfile(c *gin.Context) {
+	profile, exists := currentProfile(c)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// changes the display name and icon of the requesting player's profile
+func updateProfile(c *gin.Context) {
+	profile, exists := currentProfile(c)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Profile not found"})
+		return
+	}
+
+	request, valid := bindProfileRequest(c)
+	if !valid {
+		return
+	}
+
+	profile, err := profileStore.Update(profile.Id, request.DisplayName, request.IconName)
+	if err != nil {
+		logger.Printf("Failed to update profile %s: %v", profile.Id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update profile."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// returns anyone's profile, e.g. to see the record of a player on the leaderboard
+func getProfile(c *gin.Context) {
+	profile, err := profileStore.Get(c.Param("profileId"))
+	if errors.Is(err, profiles.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Profile not found"})
+		return
+	} else if err != nil {
+		logger.Printf("Failed to look up profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to look up profile."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// returns the players with the most wins of all time
+func getLeaderboard(c *gin.Context) {
+	standings, err := profileStore.Leaderboard(leaderboardLimit(c))
+	respondWithLeaderboard(c, standings, err)
+}
+
+// returns the players with the most wins this week
+func getWeeklyLeaderboard(c *gin.Context) {
+	standings, err := profileStore.WeeklyLeaderboard(time.Now(), leaderboardLimit(c))
+	respondWithLeaderboard(c, standings, err)
+}
+
+// returns the players who cleared the most challenges in a daily challenge ("date" query parameter, defaulting to today's)
+func getDailyLeaderboard(c *gin.Context) {
+	date := c.DefaultQuery("date", game.DailyDate(time.Now()))
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Date must look like 2024-02-13."})
+		return
+	}
+
+	standings, err := profileStore.DailyLeaderboard(date, leaderboardLimit(c))
+	if err != nil {
+		logger.Printf("Failed to build daily leaderboard: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to build leaderboard."})
+		return
+	}
+
+	if standings == nil {
+		standings = make([]profiles.DailyStanding, 0)
+	}
+	c.JSON(http.StatusOK, gin.H{"date": date, "leaderboard": standings})
+}
+
+func respondWithLeaderboard(c *gin.Context, standings []profiles.Standing, err error) {
+	if err != nil {
+		logger.Printf("Failed to build leaderboard: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to build leaderboard."})
+		return
+	}
+
+	if standings == nil {
+		standings = make([]profiles.Standing, 0)
+	}
+	c.JSON(http.StatusOK, gin.H{"leaderboard": standings})
+}
+
+// leaderboardLimit reads how many players to return from the "limit" query parameter
+func leaderboardLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLeaderboardLen
+	}
+	return min(limit, maxLeaderboardLen)
+}
@@ -0,0 +1,391 @@
+package profiles
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const maxBestWords = 5 // how many of a player's longest answers are kept on their profile
+
+var (
+	profilesBucket = []byte("profiles") // profile id to its encoded Profile
+	tokensBucket   = []byte("tokens")   // hash of a profile token to the profile id it belongs to
+	weeksBucket    = []byte("weeks")    // nested bucket per week, of profile id to the encoded Standing for that week
+	dailyBucket    = []byte("daily")    // nested bucket per date, of profile id to the encoded DailyStanding for that day's challenge
+)
+
+var ErrNotFound = errors.New("profile not found")
+
+// Profile is a player's optional account, which keeps their display name, icon and record across lobbies
+type Profile struct {
+	Id          string
+	DisplayName string
+	IconName    string
+	GamesPlayed int
+	Wins        int
+	BestWords   []string // the longest answers they've given, longest first
+	CreatedAt   time.Time
+}
+
+// Standing is a player's position on a leaderboard
+type Standing struct {
+	ProfileId   string
+	DisplayName string
+	IconName    string
+	GamesPlayed int
+	Wins        int
+}
+
+// DailyStanding is a player's position on the leaderboard of a daily challenge
+type DailyStanding struct {
+	ProfileId   string
+	DisplayName string
+	IconName    string
+	Cleared     int       // how many of the day's challenges they cleared
+	FinishedAt  time.Time // when they finished, which breaks ties
+}
+
+// GameResult is how a player with a profile did in a finished game
+type GameResult struct {
+	ProfileId   string
+	Won         bool
+	LongestWord string // their longest accepted answer in the game, or "" if they didn't give any
+}
+
+// Store keeps profiles in an embedded database file. It's safe to use from any goroutine
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if needed) the profile database at path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{profilesBucket, tokensBucket, weeksBucket, dailyBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize profile database %s: %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create creates a new profile, and returns it along with the secret token which identifies its owner
+func (s *Store) Create(displayName string, iconName string) (Profile, string, error) {
+	profile := Profile{Id: randomHex(8), DisplayName: displayName, IconName: iconName, CreatedAt: time.Now().UTC()}
+	token := randomHex(32)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(tokensBucket).Put(hashToken(token), []byte(profile.Id)); err != nil {
+			return err
+		}
+		return putProfile(tx, profile)
+	})
+	if err != nil {
+		return Profile{}, "", fmt.Errorf("failed to create profile: %w", err)
+	}
+
+	return profile, token, nil
+}
+
+// Authenticate returns the profile the token belongs to
+func (s *Store) Authenticate(token string) (Profile, error) {
+	var profile Profile
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(tokensBucket).Get(hashToken(token))
+		if id == nil {
+			return ErrNotFound
+		}
+
+		var err error
+		profile, err = getProfile(tx, string(id))
+		return err
+	})
+	return profile, err
+}
+
+func (s *Store) Get(id string) (Profile, error) {
+	var profile Profile
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		profile, err = getProfile(tx, id)
+		return err
+	})
+	return profile, err
+}
+
+// Update changes the display name and icon of a profile
+func (s *Store) Update(id string, displayName string, iconName string) (Profile, error) {
+	var profile Profile
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if profile, err = getProfile(tx, id); err != nil {
+			return err
+		}
+
+		profile.DisplayName = displayName
+		profile.IconName = iconName
+		return putProfile(tx, profile)
+	})
+	return profile, err
+}
+
+// RecordGame adds the results of a finished game to the players' profiles, and to the leaderboard for the week it finished in.
+// Results for profiles which don't exist (e.g. from a snapshot taken before a database was reset) are ignored
+func (s *Store) RecordGame(results []GameResult, finishedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		week, err := tx.Bucket(weeksBucket).CreateBucketIfNotExists([]byte(weekKey(finishedAt)))
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			profile, err := getProfile(tx, result.ProfileId)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			profile.GamesPlayed++
+			if result.Won {
+				profile.Wins++
+			}
+			profile.BestWords = addBestWord(profile.BestWords, result.LongestWord)
+			if err := putProfile(tx, profile); err != nil {
+				return err
+			}
+
+			standing := Standing{ProfileId: profile.Id}
+			if data := week.Get([]byte(profile.Id)); data != nil {
+				if err := json.Unmarshal(data, &standing); err != nil {
+					return err
+				}
+			}
+			standing.GamesPlayed++
+			if result.Won {
+				standing.Wins++
+			}
+			if err := putJson(week, profile.Id, standing); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordDaily records how a player did in the daily challenge for date (e.g. "2024-02-13"). Only their first attempt
+// each day counts, since the challenges are the same every time. Returns false if they'd already played that day's challenge
+func (s *Store) RecordDaily(profileId string, date string, cleared int, finishedAt time.Time) (bool, error) {
+	recorded := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := getProfile(tx, profileId); err != nil {
+			return err
+		}
+
+		day, err := tx.Bucket(dailyBucket).CreateBucketIfNotExists([]byte(date))
+		if err != nil {
+			return err
+		}
+
+		if day.Get([]byte(profileId)) != nil {
+			return nil
+		}
+
+		recorded = true
+		return putJson(day, profileId, DailyStanding{ProfileId: profileId, Cleared: cleared, FinishedAt: finishedAt.UTC()})
+	})
+	return recorded, err
+}
+
+// DailyLeaderboard returns the limit players who cleared the most challenges in the daily challenge for date
+func (s *Store) DailyLeaderboard(date string, limit int) ([]DailyStanding, error) {
+	var standings []DailyStanding
+	err := s.db.View(func(tx *bolt.Tx) error {
+		day := tx.Bucket(dailyBucket).Bucket([]byte(date))
+		if day == nil {
+			return nil
+		}
+
+		err := day.ForEach(func(_ []byte, data []byte) error {
+			var standing DailyStanding
+			if err := json.Unmarshal(data, &standing); err != nil {
+				return err
+			}
+
+			standings = append(standings, standing)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		slices.SortFunc(standings, func(s1 DailyStanding, s2 DailyStanding) int {
+			if s1.Cleared != s2.Cleared {
+				return s2.Cleared - s1.Cleared
+			}
+			return s1.FinishedAt.Compare(s2.FinishedAt)
+		})
+		standings = standings[:min(limit, len(standings))]
+
+		for i := range standings {
+			profile, err := getProfile(tx, standings[i].ProfileId)
+			if err != nil {
+				return err
+			}
+			standings[i].DisplayName = profile.DisplayName
+			standings[i].IconName = profile.IconName
+		}
+		return nil
+	})
+	return standings, err
+}
+
+// Leaderboard returns the limit players with the most wins of all time
+func (s *Store) Leaderboard(limit int) ([]Standing, error) {
+	var standings []Standing
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(profilesBucket).ForEach(func(_ []byte, data []byte) error {
+			var profile Profile
+			if err := json.Unmarshal(data, &profile); err != nil {
+				return err
+			}
+
+			standings = append(standings, Standing{ProfileId: profile.Id, GamesPlayed: profile.GamesPlayed, Wins: profile.Wins})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rank(standings, limit)
+}
+
+// WeeklyLeaderboard returns the limit players with the most wins in the week (starting on Monday, UTC) containing at
+func (s *Store) WeeklyLeaderboard(at time.Time, limit int) ([]Standing, error) {
+	var standings []Standing
+	err := s.db.View(func(tx *bolt.Tx) error {
+		week := tx.Bucket(weeksBucket).Bucket([]byte(weekKey(at)))
+		if week == nil {
+			return nil
+		}
+
+		return week.ForEach(func(_ []byte, data []byte) error {
+			var standing Standing
+			if err := json.Unmarshal(data, &standing); err != nil {
+				return err
+			}
+
+			standings = append(standings, standing)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rank(standings, limit)
+}
+
+// rank sorts standings by most wins, then fewest games played, keeps the top limit, and fills in the players' current names and icons
+func (s *Store) rank(standings []Standing, limit int) ([]Standing, error) {
+	standings = slices.DeleteFunc(standings, func(standing Standing) bool { return standing.GamesPlayed == 0 })
+	slices.SortFunc(standings, func(s1 Standing, s2 Standing) int {
+		if s1.Wins != s2.Wins {
+			return s2.Wins - s1.Wins
+		}
+		return s1.GamesPlayed - s2.GamesPlayed
+	})
+	standings = standings[:min(limit, len(standings))]
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for i := range standings {
+			profile, err := getProfile(tx, standings[i].ProfileId)
+			if err != nil {
+				return err
+			}
+			standings[i].DisplayName = profile.DisplayName
+			standings[i].IconName = profile.IconName
+		}
+		return nil
+	})
+	return standings, err
+}
+
+func getProfile(tx *bolt.Tx, id string) (Profile, error) {
+	data := tx.Bucket(profilesBucket).Get([]byte(id))
+	if data == nil {
+		return Profile{}, ErrNotFound
+	}
+
+	var profile Profile
+	err := json.Unmarshal(data, &profile)
+	return profile, err
+}
+
+func putProfile(tx *bolt.Tx, profile Profile) error {
+	return putJson(tx.Bucket(profilesBucket), profile.Id, profile)
+}
+
+func putJson(bucket *bolt.Bucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// addBestWord adds word to bestWords if it's one of the longest, keeping them sorted longest first
+func addBestWord(bestWords []string, word string) []string {
+	if word == "" || slices.Contains(bestWords, word) {
+		return bestWords
+	}
+
+	bestWords = append(bestWords, word)
+	slices.SortStableFunc(bestWords, func(w1 string, w2 string) int {
+		return len(w2) - len(w1)
+	})
+	return bestWords[:min(maxBestWords, len(bestWords))]
+}
+
+// weekKey identifies the ISO week containing t, e.g. "2024-W07"
+func weekKey(t time.Time) string {
+	year, week := t.UTC().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func randomHex(byteCount int) string {
+	b := make([]byte, byteCount)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("unable to generate random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const ipLimiterIdleTimeout = 10 * time.Minute // how long an IP's token bucket is kept around after its last request
+
+// ipRateLimiter keeps a token bucket per client IP
+type ipRateLimiter struct {
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*ipLimiter
+	mut      sync.Mutex
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newIpRateLimiter allows each IP perMinute requests per minute, with bursts of up to burst requests
+func newIpRateLimiter(perMinute int, burst int) *ipRateLimiter {
+	l := &ipRateLimiter{
+		limit:    rate.Limit(float64(perMinute) / 60),
+		burst:    burst,
+		limiters: make(map[string]*ipLimiter),
+	}
+	go l.forgetIdle()
+	return l
+}
+
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	entry, exists := l.limiters[ip]
+	if !exists {
+		entry = &ipLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+
+	return entry.limiter.Allow()
+}
+
+// forgetIdle periodically drops the buckets of IPs which haven't made a request in a while, so the map doesn't grow forever
+func (l *ipRateLimiter) forgetIdle() {
+	for range time.Tick(ipLimiterIdleTimeout) {
+		l.mut.Lock()
+		for ip, entry := range l.limiters {
+			if time.Since(entry.lastSeen) > ipLimiterIdleTimeout {
+				delete(l.limiters, ip)
+			}
+		}
+		l.mut.Unlock()
+	}
+}
+
+// rateLimitByIp rejects requests from IPs which have exceeded the limiter's rate
+func rateLimitByIp(limiter *ipRateLimiter) gin.HandlerFunc {
+	return rateLimitByIpWhen(limiter, func(*gin.Context) bool { return true })
+}
+
+// rateLimitByIpWhen is like rateLimitByIp, but only requests which applies is true for count toward (and are held to) the limit
+func rateLimitByIpWhen(limiter *ipRateLimiter, applies func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if applies(c) && !limiter.allow(c.ClientIP()) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"code":    "rate_limited",
+				"message": "Too many requests. Please try again shortly.",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryRegistry is a process-local Registry, for running a single instance (or standing in for a shared registry in tests).
+// Like RedisRegistry, claims expire after ttl unless renewed
+type MemoryRegistry struct {
+	claims map[string]claim // lobby id to its claim
+	ttl    time.Duration    // how long a claim lasts without being renewed, or 0 if claims never expire
+	now    func() time.Time // the current time, which tests may replace to expire claims without waiting
+	mut    sync.RWMutex
+}
+
+// claim is an instance's ownership of a lobby
+type claim struct {
+	instance  string
+	expiresAt time.Time // or zero if it never expires
+}
+
+func NewMemoryRegistry(ttl time.Duration) *MemoryRegistry {
+	return &MemoryRegistry{claims: make(map[string]claim), ttl: ttl, now: time.Now}
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, lobbyId string, instance string) (bool, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, exists := r.getClaim(lobbyId); exists {
+		return false, nil
+	}
+
+	r.claims[lobbyId] = r.newClaim(instance)
+	return true, nil
+}
+
+// Renew extends the claim, re-establishing it if it is missing (e.g. it expired, and nobody else claimed it since)
+func (r *MemoryRegistry) Renew(_ context.Context, lobbyId string, instance string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if existing, exists := r.getClaim(lobbyId); exists && existing.instance != instance {
+		return fmt.Errorf("lobby is owned by %s", existing.instance)
+	}
+
+	r.claims[lobbyId] = r.newClaim(instance)
+	return nil
+}
+
+func (r *MemoryRegistry) Lookup(_ context.Context, lobbyId string) (string, bool, error) {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+
+	existing, exists := r.getClaim(lobbyId)
+	return existing.instance, exists, nil
+}
+
+func (r *MemoryRegistry) Unregister(_ context.Context, lobbyId string, instance string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.claims[lobbyId].instance == instance { // expired claims are cleaned up too
+		delete(r.claims, lobbyId)
+	}
+	return nil
+}
+
+// getClaim returns the unexpired claim on lobbyId, if there is one. Expired claims are left for the next write to replace,
+// so this only needs the read lock
+func (r *MemoryRegistry) getClaim(lobbyId string) (claim, bool) {
+	existing, exists := r.claims[lobbyId]
+	if !exists || (!existing.expiresAt.IsZero() && !r.now().Before(existing.expiresAt)) {
+		return claim{}, false
+	}
+	return existing, true
+}
+
+func (r *MemoryRegistry) newClaim(instance string) claim {
+	if r.ttl == 0 {
+		return claim{instance: instance}
+	}
+	return claim{instance: instance, expiresAt: r.now().Add(r.ttl)}
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "wordcraft:lobby:"
+
+// renews the claim only if it is still held by the same instance (or has expired, and nobody else claimed it since)
+var renewScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+end
+return redis.error_reply("lobby is owned by " .. owner)
+`)
+
+// releases the claim only if it is still held by the same instance
+var unregisterScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisRegistry is a Registry shared between instances via Redis (or anything speaking its protocol,
+// e.g. a local redis-server during development). Claims expire after ttl unless renewed, so lobbies
+// owned by an instance that died are eventually released
+type RedisRegistry struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisRegistry connects to the Redis server at url, e.g. redis://localhost:6379/0
+func NewRedisRegistry(url string, ttl time.Duration) (*RedisRegistry, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	client := redis.NewClient(options)
+	if err = client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisRegistry{client: client, ttl: ttl}, nil
+}
+
+func (r *RedisRegistry) Register(ctx context.Context, lobbyId string, instance string) (bool, error) {
+	return r.client.SetNX(ctx, redisKeyPrefix+lobbyId, instance, r.ttl).Result()
+}
+
+func (r *RedisRegistry) Renew(ctx context.Context, lobbyId string, instance string) error {
+	return renewScript.Run(ctx, r.client, []string{redisKeyPrefix + lobbyId}, instance, r.ttl.Milliseconds()).Err()
+}
+
+func (r *RedisRegistry) Lookup(ctx context.Context, lobbyId string) (string, bool, error) {
+	instance, err := r.client.Get(ctx, redisKeyPrefix+lobbyId).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return instance, true, nil
+}
+
+func (r *RedisRegistry) Unregister(ctx context.Context, lobbyId string, instance string) error {
+	return unregisterScript.Run(ctx, r.client, []string{redisKeyPrefix + lobbyId}, instance).Err()
+}
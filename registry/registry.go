@@ -0,0 +1,25 @@
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// Registry records which server instance owns each lobby, so that any instance can route players to the owner.
+// Instances are identified by the base URL other instances can reach them at
+type Registry interface {
+	// Register claims lobbyId for instance. Returns false if the lobby is already owned by an instance
+	Register(ctx context.Context, lobbyId string, instance string) (bool, error)
+
+	// Renew extends the claim on lobbyId, so it isn't expired as belonging to a dead instance
+	Renew(ctx context.Context, lobbyId string, instance string) error
+
+	// Lookup returns the instance which owns lobbyId, or false if no instance does
+	Lookup(ctx context.Context, lobbyId string) (string, bool, error)
+
+	// Unregister releases instance's claim on lobbyId, once the lobby has ended
+	Unregister(ctx context.Context, lobbyId string, instance string) error
+}
+
+// DefaultTTL is how long a claim lasts without being renewed, for registries which expire claims
+const DefaultTTL = 2 * time.Minute
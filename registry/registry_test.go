@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+const (
+	testTtl   = time.Minute
+	instanceA = "http://a.wordcraft.test"
+	instanceB = "http://b.wordcraft.test"
+)
+
+// registryUnderTest is a Registry along with a way to move its clock forward, so claims can be expired without waiting
+type registryUnderTest struct {
+	Registry
+	advance func(d time.Duration)
+}
+
+func registries() map[string]func(t *testing.T) registryUnderTest {
+	return map[string]func(t *testing.T) registryUnderTest{
+		"memory": func(t *testing.T) registryUnderTest {
+			var mut sync.Mutex
+			now := time.Now()
+
+			r := NewMemoryRegistry(testTtl)
+			r.now = func() time.Time {
+				mut.Lock()
+				defer mut.Unlock()
+				return now
+			}
+			return registryUnderTest{Registry: r, advance: func(d time.Duration) {
+				mut.Lock()
+				defer mut.Unlock()
+				now = now.Add(d)
+			}}
+		},
+		"redis": func(t *testing.T) registryUnderTest {
+			server := miniredis.RunT(t)
+			r, err := NewRedisRegistry("redis://"+server.Addr(), testTtl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = r.client.Close() })
+			return registryUnderTest{Registry: r, advance: server.FastForward}
+		},
+	}
+}
+
+func TestRegistries(t *testing.T) {
+	for name, newRegistry := range registries() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("claim and lookup", func(t *testing.T) {
+				r := newRegistry(t)
+				assertLookup(t, r, "lobby", "", false)
+
+				assertRegister(t, r, "lobby", instanceA, true)
+				assertLookup(t, r, "lobby", instanceA, true)
+
+				// claimed lobbies can't be taken by another instance, or claimed again
+				assertRegister(t, r, "lobby", instanceB, false)
+				assertRegister(t, r, "lobby", instanceA, false)
+				assertLookup(t, r, "lobby", instanceA, true)
+			})
+
+			t.Run("release", func(t *testing.T) {
+				r := newRegistry(t)
+				assertRegister(t, r, "lobby", instanceA, true)
+
+				// only the owner can release its claim
+				assertUnregister(t, r, "lobby", instanceB)
+				assertLookup(t, r, "lobby", instanceA, true)
+
+				assertUnregister(t, r, "lobby", instanceA)
+				assertLookup(t, r, "lobby", "", false)
+				assertRegister(t, r, "lobby", instanceB, true)
+			})
+
+			t.Run("ttl expiry", func(t *testing.T) {
+				r := newRegistry(t)
+				assertRegister(t, r, "lobby", instanceA, true)
+
+				r.advance(testTtl - time.Second)
+				assertLookup(t, r, "lobby", instanceA, true)
+
+				r.advance(2 * time.Second)
+				assertLookup(t, r, "lobby", "", false)
+
+				// once expired, the lobby is up for grabs (e.g. its owner died)
+				assertRegister(t, r, "lobby", instanceB, true)
+				assertLookup(t, r, "lobby", instanceB, true)
+			})
+
+			t.Run("renew", func(t *testing.T) {
+				r := newRegistry(t)
+				assertRegister(t, r, "lobby", instanceA, true)
+
+				r.advance(testTtl - time.Second)
+				if err := r.Renew(context.Background(), "lobby", instanceA); err != nil {
+					t.Fatalf("Renew() by the owner failed: %v", err)
+				}
+
+				r.advance(testTtl - time.Second)
+				assertLookup(t, r, "lobby", instanceA, true)
+
+				if err := r.Renew(context.Background(), "lobby", instanceB); err == nil {
+					t.Errorf("Renew() of a lobby owned by another instance succeeded")
+				}
+				assertLookup(t, r, "lobby", instanceA, true)
+			})
+
+			t.Run("renew restores expired claim", func(t *testing.T) {
+				r := newRegistry(t)
+				assertRegister(t, r, "lobby", instanceA, true)
+
+				r.advance(testTtl + time.Second)
+				if err := r.Renew(context.Background(), "lobby", instanceA); err != nil {
+					t.Fatalf("Renew() of an expired claim failed: %v", err)
+				}
+				assertLookup(t, r, "lobby", instanceA, true)
+			})
+		})
+	}
+}
+
+func assertRegister(t *testing.T, r Registry, lobbyId string, instance string, want bool) {
+	t.Helper()
+
+	claimed, err := r.Register(context.Background(), lobbyId, instance)
+	if err != nil {
+		t.Fatalf("Register(%s, %s) failed: %v", lobbyId, instance, err)
+	}
+	if claimed != want {
+		t.Errorf("Register(%s, %s) = %t, want %t", lobbyId, instance, claimed, want)
+	}
+}
+
+func assertLookup(t *testing.T, r Registry, lobbyId string, wantInstance string, wantExists bool) {
+	t.Helper()
+
+	instance, exists, err := r.Lookup(context.Background(), lobbyId)
+	if err != nil {
+		t.Fatalf("Lookup(%s) failed: %v", lobbyId, err)
+	}
+	if instance != wantInstance || exists != wantExists {
+		t.Errorf("Lookup(%s) = %q, %t, want %q, %t", lobbyId, instance, exists, wantInstance, wantExists)
+	}
+}
+
+func assertUnregister(t *testing.T, r Registry, lobbyId string, instance string) {
+	t.Helper()
+
+	if err := r.Unregister(context.Background(), lobbyId, instance); err != nil {
+		t.Fatalf("Unregister(%s, %s) failed: %v", lobbyId, instance, err)
+	}
+}
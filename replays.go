@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/game"
+)
+
+// replayDir is where the replays of finished games are written, or "" if replays are disabled
+var replayDir = getEnv("REPLAY_DIR", "./replays")
+
+// replay ids are made of a lobby id and a timestamp, anything else can't be a replay (and mustn't be used as a file name)
+var replayIdPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func replaysEnabled() bool {
+	return replayDir != ""
+}
+
+func replayPath(replayId string) string {
+	return filepath.Join(replayDir, replayId+".json")
+}
+
+// startSavingReplays makes every finished game's replay get written to replayDir
+func startSavingReplays() error {
+	if !replaysEnabled() {
+		return nil
+	}
+
+	if err := os.MkdirAll(replayDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create replay directory %s: %w", replayDir, err)
+	}
+
+	game.SaveReplay = saveReplay
+	return nil
+}
+
+// saveReplay writes the replay to disk, atomically so a partially written replay is never served
+func saveReplay(replay game.Replay) {
+	data, err := json.Marshal(replay)
+	if err != nil {
+		logger.Printf("Failed to encode replay %s: %v", replay.Id, err)
+		return
+	}
+
+	tmpPath := replayPath(replay.Id) + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o600); err != nil {
+		logger.Printf("Failed to write replay %s: %v", replay.Id, err)
+		return
+	}
+
+	if err = os.Rename(tmpPath, replayPath(replay.Id)); err != nil {
+		logger.Printf("Failed to write replay %s: %v", replay.Id, err)
+	}
+}
+
+// returns the replay of a finished game, so it can be stepped through turn by turn
+func getReplay(c *gin.Context) {
+	replayId := c.Param("replayId")
+	if !replayIdPattern.MatchString(replayId) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Replay not found"})
+		return
+	}
+
+	data, err := os.ReadFile(replayPath(replayId))
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Replay not found"})
+		return
+	} else if err != nil {
+		logger.Printf("Failed to read replay %s: %v", replayId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read replay."})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", data)
+}
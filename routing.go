@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/registry"
+)
+
+const (
+	registryTimeout = 2 * time.Second   // how long to wait on the registry before giving up on a request
+	forwardedHeader = "X-Wordcraft-Hop" // set on requests proxied between instances, so they are never proxied twice
+)
+
+// instanceUrl is the base URL other instances can reach this one at. It identifies this instance in the registry
+var instanceUrl = getEnv("INSTANCE_URL", "http://localhost:"+getEnv("PORT", "8080"))
+
+// redirectToOwner makes requests for lobbies owned by another instance redirect there, rather than be proxied to it.
+// This only works if every instance's INSTANCE_URL is reachable by players
+var redirectToOwner = getEnv("LOBBY_ROUTING", "proxy") == "redirect"
+
+var lobbyRegistry registry.Registry
+
+var ownerProxies sync.Map // instance URL to the *httputil.ReverseProxy which forwards requests to it
+
+// newRegistry returns a Redis backed registry when REGISTRY_REDIS_URL is set (to share lobbies between instances),
+// or an in-memory registry otherwise
+func newRegistry() (registry.Registry, error) {
+	redisUrl := getEnv("REGISTRY_REDIS_URL", "")
+	if redisUrl == "" {
+		return registry.NewMemoryRegistry(registry.DefaultTTL), nil
+	}
+
+	if len(trustedProxies) == 0 {
+		// the owner of a lobby sees proxied players as coming from the instance which proxied them
+		logger.Printf("Warning: REGISTRY_REDIS_URL is set without TRUSTED_PROXIES, so players proxied from other instances " +
+			"are rate limited and banned by that instance's address. List the instances' addresses in TRUSTED_PROXIES")
+	}
+
+	return registry.NewRedisRegistry(redisUrl, registry.DefaultTTL)
+}
+
+// routeToOwner sends requests for a lobby which lives on another instance to that instance.
+// Requests for lobbies on this instance (or which don't exist anywhere) are handled as normal
+func routeToOwner(c *gin.Context) {
+	lobbyId := c.Param("lobbyId")
+	if lobbies.Has(lobbyId) || c.GetHeader(forwardedHeader) != "" {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), registryTimeout)
+	defer cancel()
+
+	owner, found, err := lobbyRegistry.Lookup(ctx, lobbyId)
+	if err != nil {
+		logger.Printf("Failed to look up the owner of lobby %s: %v", lobbyId, err)
+		c.Next()
+		return
+	}
+
+	if !found || owner == instanceUrl {
+		c.Next()
+		return
+	}
+
+	ownerUrl, err := url.Parse(owner)
+	if err != nil {
+		logger.Printf("Lobby %s is owned by an instance with an invalid url %q: %v", lobbyId, owner, err)
+		c.Next()
+		return
+	}
+
+	c.Abort()
+	if redirectToOwner && isRedirectable(c) {
+		c.Redirect(http.StatusTemporaryRedirect, ownerUrl.JoinPath(c.Request.URL.Path).String()+queryString(c.Request.URL))
+		return
+	}
+
+	c.Request.Header.Set(forwardedHeader, instanceUrl)
+	getOwnerProxy(ownerUrl).ServeHTTP(c.Writer, c.Request)
+}
+
+// isRedirectable reports whether a request can be redirected to the lobby's owner. Browsers fail websocket handshakes
+// and event streams which are redirected, so those (and the messages posted alongside event streams) are always proxied
+func isRedirectable(c *gin.Context) bool {
+	return !strings.HasPrefix(c.FullPath(), "/ws/") && !strings.HasPrefix(c.FullPath(), "/sse/")
+}
+
+func getOwnerProxy(ownerUrl *url.URL) *httputil.ReverseProxy {
+	if proxy, exists := ownerProxies.Load(ownerUrl.String()); exists {
+		return proxy.(*httputil.ReverseProxy)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(ownerUrl)
+	proxy.FlushInterval = -1 // flush immediately, so event streams aren't buffered
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Printf("Failed to proxy %s to %s: %v", r.URL.Path, ownerUrl, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	actual, _ := ownerProxies.LoadOrStore(ownerUrl.String(), proxy)
+	return actual.(*httputil.ReverseProxy)
+}
+
+func queryString(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// renewLobbyClaims periodically renews this instance's claim on each of its lobbies
+func renewLobbyClaims(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, lobbyId := range lobbies.Keys() {
+			ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+			if err := lobbyRegistry.Renew(ctx, lobbyId, instanceUrl); err != nil {
+				logger.Printf("Failed to renew claim on lobby %s: %v", lobbyId, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// unregisterLobby releases this instance's claim on a lobby which has ended
+func unregisterLobby(lobbyId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+
+	if err := lobbyRegistry.Unregister(ctx, lobbyId, instanceUrl); err != nil {
+		logger.Printf("Failed to unregister lobby %s: %v", lobbyId, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhshelnu/wordcraft/registry"
+)
+
+func TestRouteToOwnerRedirectsOnlyPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(owner.Close)
+
+	previousRegistry, previousRedirect := lobbyRegistry, redirectToOwner
+	lobbyRegistry, redirectToOwner = registry.NewMemoryRegistry(registry.DefaultTTL), true
+	t.Cleanup(func() { lobbyRegistry, redirectToOwner = previousRegistry, previousRedirect })
+	if _, err := lobbyRegistry.Register(context.Background(), "elsewhere", owner.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	server := gin.New()
+	server.GET("/lobby/:lobbyId", routeToOwner)
+	server.GET("/ws/:lobbyId", routeToOwner)
+	server.GET("/sse/:lobbyId", routeToOwner)
+	server.POST("/sse/:lobbyId", routeToOwner)
+	front := httptest.NewServer(server)
+	t.Cleanup(front.Close)
+
+	// report redirects rather than following them, like a browser opening a websocket or event stream can't
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/lobby/elsewhere", want: http.StatusTemporaryRedirect},
+		{method: http.MethodGet, path: "/ws/elsewhere", want: http.StatusOK},
+		{method: http.MethodGet, path: "/sse/elsewhere", want: http.StatusOK},
+		{method: http.MethodPost, path: "/sse/elsewhere", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			request, err := http.NewRequest(test.method, front.URL+test.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = response.Body.Close()
+
+			if response.StatusCode != test.want {
+				t.Errorf("%s %s responded %d, want %d", test.method, test.path, response.StatusCode, test.want)
+			}
+		})
+	}
+}
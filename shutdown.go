@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jhshelnu/wordcraft/game"
+)
+
+const (
+	drainProgressInterval = 5 * time.Second // how often to log progress while draining
+	shutdownNoticePeriod  = 8 * time.Second // how long clients get to see the shutdown message when their game is cut short
+	httpShutdownTimeout   = 5 * time.Second // how long in-flight requests get to finish once the lobbies are done
+)
+
+// shutdown drains the server: no new lobbies or players are accepted, games in progress are allowed to finish
+// (up to SHUTDOWN_DRAIN_SECONDS, after which they are saved to be restored on startup), and then the http server is shut down
+func shutdown(httpServer *http.Server) {
+	draining.Store(true)
+	drainDeadline := time.Duration(getEnvInt("SHUTDOWN_DRAIN_SECONDS", 60)) * time.Second
+
+	logger.Printf("Received request to shutdown. Draining %d lobbies (deadline %s).", lobbies.Count(), drainDeadline)
+	lobbies.IterCb(func(_ string, lobby *game.Lobby) {
+		go lobby.Drain()
+	})
+
+	if !awaitLobbiesEnded(drainDeadline) && snapshotsEnabled() {
+		logger.Printf("Drain deadline reached with %d lobbies remaining. Saving them to be restored after the restart.", lobbies.Count())
+		suspendLobbies()
+		time.Sleep(shutdownNoticePeriod) // give the clients enough time to see the shutdown message
+	} else if lobbies.Count() > 0 {
+		logger.Printf("Drain deadline reached with %d lobbies remaining. Shutting them down now.", lobbies.Count())
+		lobbies.IterCb(func(_ string, lobby *game.Lobby) {
+			go lobby.Shutdown()
+		})
+		time.Sleep(shutdownNoticePeriod) // give the clients enough time to see the shutdown message and be redirected to the home screen
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Printf("HTTP server did not shut down cleanly: %v", err)
+		_ = httpServer.Close()
+	}
+	closeProfileStore()
+
+	logger.Printf("Shutdown complete. Goodbye.")
+}
+
+// awaitLobbiesEnded waits for every lobby to end, logging progress along the way.
+// Returns false if there are still lobbies remaining after the deadline
+func awaitLobbiesEnded(deadline time.Duration) bool {
+	timeout := time.After(deadline)
+	progress := time.NewTicker(drainProgressInterval)
+	defer progress.Stop()
+	check := time.NewTicker(100 * time.Millisecond)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-check.C:
+			if lobbies.Count() == 0 {
+				logger.Printf("All lobbies have ended.")
+				return true
+			}
+		case <-progress.C:
+			logger.Printf("Draining: %d lobbies remaining", lobbies.Count())
+		case <-timeout:
+			return false
+		}
+	}
+}
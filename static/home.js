@@ -1,8 +1,24 @@
 document.addEventListener("DOMContentLoaded", () => {
     let createLobby = document.getElementById("create-lobby")
+    let createLobbyPassword = document.getElementById("create-lobby-password") // setting a password makes the lobby private
+    let createLobbyPublic = document.getElementById("create-lobby-public")     // whether to list the lobby for anyone to join
+    let quickPlay = document.getElementById("quick-play")
+    let dailyChallenge = document.getElementById("daily-challenge")
+
+    createLobbyPassword.addEventListener("input", () => {
+        // private lobbies can't be listed
+        createLobbyPublic.disabled = createLobbyPassword.value !== ""
+        if (createLobbyPublic.disabled) {
+            createLobbyPublic.checked = false
+        }
+    })
 
     createLobby.addEventListener("click", async () => {
-        let res = await fetch("/api/lobby", { method: "POST" })
+        let res = await fetch("/api/lobby", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ password: createLobbyPassword.value, public: createLobbyPublic.checked }),
+        })
         let body = await res.json()
         if (!res.ok) {
             console.log(res)
@@ -16,4 +32,156 @@ document.addEventListener("DOMContentLoaded", () => {
             window.location.href = "/lobby/" + lobbyId
         }
     })
-})
\ No newline at end of file
+
+    quickPlay.addEventListener("click", async () => {
+        let res = await fetch("/api/quickplay", { method: "POST" })
+        let body = await res.json()
+        if (!res.ok) {
+            console.log(res)
+            toast(`Failed to find a lobby. ${body["message"] ?? "Unknown error. See console for details."}`, "alert-error")
+            return
+        }
+
+        window.location.href = "/lobby/" + body["lobbyId"]
+    })
+
+    // the daily challenge is played alone, in a lobby of its own
+    dailyChallenge.addEventListener("click", async () => {
+        let res = await fetch("/api/daily", { method: "POST" })
+        let body = await res.json()
+        if (!res.ok) {
+            console.log(res)
+            toast(`Failed to start the daily challenge. ${body["message"] ?? "Unknown error. See console for details."}`, "alert-error")
+            return
+        }
+
+        window.location.href = "/lobby/" + body["lobbyId"]
+    })
+
+    renderOpenLobbies()
+
+    // profiles are optional, and only shown when the server has them enabled
+    if (document.getElementById("profile")) {
+        setUpProfile()
+    }
+})
+
+// lists the public lobbies which are waiting for players
+async function renderOpenLobbies() {
+    let res = await fetch("/api/lobbies")
+    if (!res.ok) {
+        return
+    }
+
+    let lobbies = (await res.json())["lobbies"]
+    let openLobbiesBody = document.getElementById("open-lobbies-body")
+    openLobbiesBody.replaceChildren()
+    lobbies.forEach(lobby => {
+        let row = document.createElement("tr")
+        row.innerHTML = `
+            <td>${lobby["lobbyId"]}</td>
+            <td>${describeGame(lobby)}</td>
+            <td>${lobby["players"]}/${lobby["maxPlayers"]}</td>
+            <td><a class="btn btn-primary" href="/lobby/${lobby["lobbyId"]}">Join</a></td>
+        `
+        openLobbiesBody.appendChild(row)
+    })
+
+    document.getElementById("open-lobbies").classList.toggle("hidden", lobbies.length === 0)
+}
+
+// describes how an open lobby's games are played, e.g. "Scoring, 5 rounds, first to 50"
+function describeGame(lobby) {
+    if (lobby["mode"] !== "scoring") {
+        return "Elimination"
+    }
+
+    let description = "Scoring"
+    if (lobby["rounds"] > 0) {
+        description += `, ${lobby["rounds"]} rounds`
+    }
+    if (lobby["targetScore"] > 0) {
+        description += `, first to ${lobby["targetScore"]}`
+    }
+    return description
+}
+// shows the player's profile (if they have one) and lets them create or edit it, along with the leaderboards
+async function setUpProfile() {
+    let displayNameInput = document.getElementById("profile-display-name")
+    let iconSelect = document.getElementById("profile-icon")
+    let saveProfile = document.getElementById("save-profile")
+    let leaderboardPeriod = document.getElementById("leaderboard-period")
+
+    for (let option of iconSelect.options) {
+        option.textContent = option.value.replace(/\.[a-z]+$/, "")
+    }
+
+    let hasProfile = false
+    let res = await fetch("/api/profile")
+    if (res.ok) {
+        hasProfile = true
+        renderProfile((await res.json())["profile"])
+    }
+
+    saveProfile.addEventListener("click", async () => {
+        let res = await fetch("/api/profile", {
+            method: hasProfile ? "PUT" : "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ displayName: displayNameInput.value, iconName: iconSelect.value }),
+        })
+        let body = await res.json()
+        if (!res.ok) {
+            console.log(res)
+            toast(`Failed to save profile. ${body["message"] ?? "Unknown error. See console for details."}`, "alert-error")
+            return
+        }
+
+        hasProfile = true
+        renderProfile(body["profile"])
+        renderLeaderboard(leaderboardPeriod.value)
+    })
+
+    leaderboardPeriod.addEventListener("change", () => renderLeaderboard(leaderboardPeriod.value))
+    renderLeaderboard(leaderboardPeriod.value)
+}
+
+function renderProfile(profile) {
+    document.getElementById("profile-display-name").value = profile["DisplayName"]
+    document.getElementById("profile-icon").value = profile["IconName"]
+    document.getElementById("save-profile-text").textContent = "Save profile"
+
+    let record = `${profile["Wins"]} wins in ${profile["GamesPlayed"]} games`
+    if (profile["BestWords"]?.length) {
+        record += `. Best words: ${profile["BestWords"].join(", ")}`
+    }
+    let profileRecord = document.getElementById("profile-record")
+    profileRecord.textContent = record
+    profileRecord.classList.remove("hidden")
+}
+
+// period is "" for the all time leaderboard, "weekly", or "daily" (which ranks today's daily challenge by challenges cleared)
+async function renderLeaderboard(period) {
+    let res = await fetch("/api/leaderboard" + (period ? "/" + period : ""))
+    if (!res.ok) {
+        return
+    }
+
+    const daily = period === "daily"
+    document.getElementById("leaderboard-score-header").textContent = daily ? "Cleared" : "Wins"
+    document.getElementById("leaderboard-games-header").classList.toggle("hidden", daily)
+
+    let leaderboard = (await res.json())["leaderboard"]
+    let leaderboardBody = document.getElementById("leaderboard-body")
+    leaderboardBody.replaceChildren()
+    leaderboard.forEach((standing, i) => {
+        let row = document.createElement("tr")
+        row.innerHTML = `
+            <td>${i + 1}</td>
+            <td class="flex flex-row gap-2"><img class="rounded-full" width="32" height="32" src="/static/icons/${standing["IconName"]}" alt=""><span></span></td>
+            <td>${daily ? standing["Cleared"] : standing["Wins"]}</td>
+            <td class="${daily ? "hidden" : ""}">${standing["GamesPlayed"]}</td>
+        `
+        row.querySelector("span").textContent = standing["DisplayName"] // display names are chosen by players, so aren't trusted as html
+        leaderboardBody.appendChild(row)
+    })
+}
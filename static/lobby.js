@@ -15,19 +15,45 @@ const GAME_OVER       = "game_over"       // the game is over
 const RESTART_GAME    = "restart_game"    // sent from a client to initiate a game restart. sever then rebroadcasts to all clients to confirm
 const NAME_CHANGE     = "name_change"     // used by clients to indicate they want a new display name
 const SHUTDOWN        = "shutdown"         // tells the clients the server is being shutdown now
+const TIME_SYNC_REQ   = "time_sync_req"   // asks the server for a sample of its clock
+const TIME_SYNC       = "time_sync"       // the server's response to a time sync request
+const IDLE_WARNING    = "idle_warning"    // the lobby will close soon unless something happens
+const LOBBY_CLOSED    = "lobby_closed"    // the lobby is closing our connection, and tells us why
+const ERROR           = "error"           // something we did was not allowed
+const HOST_CHANGED    = "host_changed"    // a new client has become the host
+const KICK_CLIENT     = "kick_client"     // sent by the host to remove a client from the lobby
+const BAN_CLIENT      = "ban_client"      // sent by the host to remove a client from the lobby and stop them rejoining
+const SPECTATE_CHANGE = "spectate_change" // used by clients to start or stop spectating
+const CHANGE_SETTINGS = "change_settings" // used by the host to change the game settings
+const POINTS_AWARDED  = "points_awarded"  // an accepted answer earned points (scoring mode only)
+
+// different values for gameMode
+const ELIMINATION = "elimination"
+const SCORING = "scoring"
+const DAILY = "daily" // a solo daily challenge, whose settings can't be changed
 
 // different values for gameStatus that indicate what point we're at in the game
 const WAITING_FOR_PLAYERS = 0
 const IN_PROGRESS = 1
 const OVER = 2
 
-let ws                    // the websocket connection
+let conn                  // the connection to the server (a websocket, or an event stream if websockets are blocked)
 let myClientId            // our assigned id for the lobby we're joining
+let hostId                // the id of the client who can start the game and kick or ban other clients
 let gameStatus            // the status of the game
 let myDisplayNameInput    // the <input> which holds our current displayName
 let startGameButton       // the button to start the game
 let restartGameButton     // the button to restart the game
 let inviteButton          // the button that copies the lobby link to the clipboard
+let spectateButton        // the button that switches between playing and spectating
+let spectatorCount        // text showing how many clients are spectating
+let amSpectating = false  // whether we are only spectating (we're never given a turn)
+let gameSettings          // how games in the lobby are played ({ Mode, Rounds, TargetScore, Seed })
+let gameSettingsSection   // the section holding the game settings (only shown between games)
+let modeSelect            // the <select> for the game mode
+let roundsSelect          // the <select> for how many rounds a scoring game lasts
+let targetScoreSelect     // the <select> for the score which ends a scoring game
+let seedInput             // the <input> for the seed every game is played with (empty for a new seed each game)
 let inviteButtonText      // the text of the invite button (changes after being clicked)
 let clientsTurnId         // the id of the client whose turn it is
 let challengeInputSection // the part of the page to get the user's input (only shown during their turn)
@@ -37,6 +63,18 @@ let clientsList           // the section showing all of the client cards
 let turnCountdownInterval // the interval where we count down how many seconds the user has left
 let suggestionsTable      // the <table> holding suggestions
 let suggestionsBody       // the <tbody> holding the specific suggestions
+let statsTable            // the <table> holding each player's stats, shown once a game is over
+let replayLink            // the <a> linking to the replay of the last game, shown once a game is over (if it was recorded)
+let statsBody             // the <tbody> holding each player's stats
+
+const TIME_SYNC_SAMPLES    = 5       // how many clock samples to take each time we sync with the server
+const TIME_SYNC_SPACING    = 250     // milliseconds between each sample
+const TIME_SYNC_INTERVAL   = 30_000  // milliseconds between each round of samples
+const TIME_SYNC_MAX_KEPT   = 20      // how many of the most recent samples to pick the best estimate from
+let timeSyncSamples = []  // recent { offset, rtt } samples, where offset is how far the server's clock is ahead of ours
+let lastTimeSync = {}     // the ServerSend of the latest time sync response, and when we received it (lets the server measure rtt too)
+let timeSyncInterval      // the interval where we periodically re-sync our clock with the server
+let expectingClose = false // set when the server has told us our connection is about to close, so the close itself doesn't send us home
 
 const VOLUME = 0.4 // how loud to play the audio
 let answerAcceptedAudio    // what plays when an answer is accepted
@@ -44,13 +82,18 @@ let clientJoinedAudio      // what plays when another client joins
 let clientEliminated       // what plays when time runs out for a client
 
 document.addEventListener("DOMContentLoaded", () => {
-    // establish websocket connection right away
-    const protocol = isProd ? "wss" : "ws"
-    const reconnectToken = localStorage.getItem("reconnectToken")
-    ws = new WebSocket(`${protocol}://${location.host}/ws/${lobbyId}${reconnectToken ? `?reconnectToken=${reconnectToken}` : ""}`)
+    // establish the connection right away
+    connect()
     startGameButton = document.getElementById("start-game-button")
     restartGameButton = document.getElementById("restart-game-button")
     inviteButton = document.getElementById("invite-button")
+    spectateButton = document.getElementById("spectate-button")
+    spectatorCount = document.getElementById("spectator-count")
+    gameSettingsSection = document.getElementById("game-settings")
+    modeSelect = document.getElementById("mode-select")
+    roundsSelect = document.getElementById("rounds-select")
+    targetScoreSelect = document.getElementById("target-score-select")
+    seedInput = document.getElementById("seed-input")
     inviteButtonText = document.getElementById("invite-button-text")
     challengeInputSection = document.getElementById("challenge-input-section")
     answerInput = document.getElementById("answer-input")
@@ -58,90 +101,214 @@ document.addEventListener("DOMContentLoaded", () => {
     clientsList = document.getElementById("clients-list")
     suggestionsTable = document.getElementById("suggestions-table")
     suggestionsBody = document.getElementById("suggestions-body")
+    statsTable = document.getElementById("stats-table")
+    replayLink = document.getElementById("replay-link")
+    statsBody = document.getElementById("stats-body")
 
     answerAcceptedAudio = new Audio("/static/sounds/answer_accepted.mp3")
     clientJoinedAudio   = new Audio("/static/sounds/client_joined.mp3")
     clientEliminated    = new Audio("/static/sounds/client_eliminated.wav")
 
     startGameButton.addEventListener("click", () => {
-        ws.send(JSON.stringify({ Type: START_GAME }))
+        send({ Type: START_GAME })
     })
 
     restartGameButton.addEventListener("click", () => {
-        ws.send(JSON.stringify({ Type: RESTART_GAME }))
+        send({ Type: RESTART_GAME })
     })
 
-    inviteButton.addEventListener("click", async () => {
-        await navigator.clipboard.writeText(location.href)
-        inviteButtonText.textContent = "Copied!"
-    })
+    // kick and ban buttons are only rendered on other clients' cards, and only for the host
+    clientsList.addEventListener("click", e => {
+        const button = e.target.closest("[data-kick], [data-ban]")
+        if (!button) {
+            return
+        }
 
-    ws.onmessage = ({ data }) => {
-        let message = JSON.parse(data)
-        let type = message["Type"]
-        let content = message["Content"]
-        switch (type) {
-            case CLIENT_DETAILS:
-                onClientDetails(content)
-                break
-            case CLIENT_JOINED:
-                onClientJoined(content)
-                break
-            case CLIENT_LEFT:
-                onClientLeft(content)
-                break
-            case NAME_CHANGE:
-                onNameChange(content)
-                break
-            case CLIENTS_TURN:
-                onClientsTurn(content)
-                break
-            case ANSWER_PREVIEW:
-                onAnswerPreview(content)
-                break
-            case ANSWER_ACCEPTED:
-                onAnswerAccepted()
-                break
-            case ANSWER_REJECTED:
-                onAnswerRejected()
-                break
-            case TURN_EXPIRED:
-                onTurnExpired(content)
-                break
-            case GAME_OVER:
-                onGameOver(content)
-                break
-            case RESTART_GAME:
-                onRestartGame()
-                break
-            case SHUTDOWN:
-                onShutdown()
-                break
+        const clientId = Number(button.closest("[data-client-id]").dataset.clientId)
+        const displayName = button.closest("[data-client-id]").querySelector("[data-display-name]").textContent
+        if (button.hasAttribute("data-ban")) {
+            if (confirm(`Ban ${displayName}? They won't be able to rejoin this lobby.`)) {
+                send({ Type: BAN_CLIENT, Content: clientId })
+            }
+        } else {
+            send({ Type: KICK_CLIENT, Content: clientId })
         }
+    })
+
+    // only the host can change the settings, the server rebroadcasts the change to everyone (including us)
+    for (const select of [modeSelect, roundsSelect, targetScoreSelect, seedInput]) {
+        select.addEventListener("change", () => {
+            send({ Type: CHANGE_SETTINGS, Content: {
+                Mode: modeSelect.value,
+                Rounds: Number(roundsSelect.value),
+                TargetScore: Number(targetScoreSelect.value),
+                Seed: Number(seedInput.value),
+            }})
+        })
     }
 
-    ws.onclose = () => location.href = "/"
+    spectateButton.addEventListener("click", () => {
+        send({ Type: SPECTATE_CHANGE, Content: !amSpectating })
+    })
+
+    inviteButton.addEventListener("click", async () => {
+        await navigator.clipboard.writeText(location.href)
+        inviteButtonText.textContent = "Copied!"
+    })
 
     answerInput.addEventListener("input", () => {
         let currentInput = answerInput.value.toLowerCase()
-        ws.send(JSON.stringify({ Type: ANSWER_PREVIEW, Content: currentInput }))
+        send({ Type: ANSWER_PREVIEW, Content: currentInput })
     })
 
     answerInput.addEventListener("keyup", e => {
         e.preventDefault()
         let input = answerInput.value.toLowerCase().trim()
         if (input && e.key === "Enter") {
-            ws.send(JSON.stringify({ Type: SUBMIT_ANSWER, Content: input }))
+            send({ Type: SUBMIT_ANSWER, Content: input })
         }
     })
 })
 
+// connects to the lobby over a websocket, falling back to an event stream if the websocket can't be established
+// (some networks block websocket upgrades)
+function connect() {
+    const protocol = isProd ? "wss" : "ws"
+    const params = new URLSearchParams()
+    const reconnectToken = localStorage.getItem("reconnectToken")
+    if (reconnectToken) {
+        params.set("reconnectToken", reconnectToken)
+    }
+    if (lobbyAccessToken) {
+        params.set("access", lobbyAccessToken) // stands in for the password or invite code, for private lobbies
+    }
+    if (joinAsSpectator) {
+        params.set("spectate", "true")
+    }
+    const query = params.size ? `?${params}` : ""
+
+    let opened = false
+    // the server prefers msgpack, which arrives in binary frames; ws.protocol says which one it picked
+    const ws = new WebSocket(`${protocol}://${location.host}/ws/${lobbyId}${query}`, ["msgpack", "json"])
+    ws.binaryType = "arraybuffer"
+    ws.onopen = () => opened = true
+    ws.onmessage = ({ data }) => onMessage(ws.protocol === "msgpack" ? msgpack.decode(data) : JSON.parse(data))
+    ws.onclose = () => {
+        if (expectingClose) {
+            return
+        } else if (opened) {
+            location.href = "/"
+        } else {
+            connectEventStream(query)
+        }
+    }
+
+    conn = { send: message => ws.send(ws.protocol === "msgpack" ? msgpack.encode(message) : JSON.stringify(message)) }
+}
+
+// receives messages via Server-Sent Events, and sends them via POST requests identified by our reconnect token
+function connectEventStream(query) {
+    const eventSource = new EventSource(`/sse/${lobbyId}${query}`)
+    eventSource.onmessage = ({ data }) => onMessage(JSON.parse(data))
+    eventSource.onerror = () => {
+        eventSource.close()
+        if (!expectingClose) {
+            location.href = "/"
+        }
+    }
+
+    conn = {
+        send: message => fetch(`/sse/${lobbyId}`, {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+                "X-Reconnect-Token": localStorage.getItem("reconnectToken"),
+            },
+            body: JSON.stringify(message),
+        })
+    }
+}
+
+// sends a message to the server over whichever connection was established
+function send(message) {
+    conn.send(message)
+}
+
+function onMessage(message) {
+    let type = message["Type"]
+    let content = message["Content"]
+    switch (type) {
+        case CLIENT_DETAILS:
+            onClientDetails(content)
+            break
+        case CLIENT_JOINED:
+            onClientJoined(content)
+            break
+        case CLIENT_LEFT:
+            onClientLeft(content)
+            break
+        case NAME_CHANGE:
+            onNameChange(content)
+            break
+        case CLIENTS_TURN:
+            onClientsTurn(content)
+            break
+        case ANSWER_PREVIEW:
+            onAnswerPreview(content)
+            break
+        case ANSWER_ACCEPTED:
+            onAnswerAccepted()
+            break
+        case ANSWER_REJECTED:
+            onAnswerRejected()
+            break
+        case TURN_EXPIRED:
+            onTurnExpired(content)
+            break
+        case GAME_OVER:
+            onGameOver(content)
+            break
+        case RESTART_GAME:
+            onRestartGame()
+            break
+        case SHUTDOWN:
+            onShutdown(content)
+            break
+        case TIME_SYNC:
+            onTimeSync(content)
+            break
+        case IDLE_WARNING:
+            onIdleWarning(content)
+            break
+        case LOBBY_CLOSED:
+            onLobbyClosed(content)
+            break
+        case ERROR:
+            onError(content)
+            break
+        case HOST_CHANGED:
+            onHostChanged(content)
+            break
+        case SPECTATE_CHANGE:
+            onSpectateChange(content)
+            break
+        case CHANGE_SETTINGS:
+            onChangeSettings(content)
+            break
+        case POINTS_AWARDED:
+            onPointsAwarded(content)
+            break
+    }
+}
+
 // this message is broadcast from the server to one particular client at the moment of connection
 // its job is to catch the client up on details-- what their id is, the current state of the game, etc
 function onClientDetails(content) {
     myClientId = content["ClientId"] // this is our assigned clientId for the rest of the lobby
     let reconnectToken = content["ReconnectToken"] // a special token that can be used to reconnect to the game
     gameStatus = content["Status"]   // the status of the game (need to know if it's started yet or not)
+    hostId = content["HostId"]       // the id of the client who is the host
+    gameSettings = content["Settings"] // how games in the lobby are played
     let clients = content["Clients"] // all the clients that are already in the game
     clientsTurnId = content["CurrentTurnId"] // the id of the client whose turn it is (or 0 if not applicable)
     let currentChallenge = content["CurrentChallenge"] // what the current challenge is, or "" if there isn't one
@@ -153,26 +320,39 @@ function onClientDetails(content) {
     // render the clients
     clientsList.replaceChildren() // clears all existing client cards in case of a reconnection
     clients.forEach(client => {
-        renderNewClientCard(client["Id"], client["DisplayName"], client["IconName"], client["Alive"], client["Id"] === myClientId)
+        renderNewClientCard(client["Id"], client["DisplayName"], client["IconName"], client["Alive"], client["Spectator"], client["Id"] === myClientId)
+        if (client["Id"] === myClientId) {
+            amSpectating = client["Spectator"]
+        }
+        renderScore(client["Id"], client["Score"])
     })
 
-    if (clientsList.children.length >= 2) {
-        startGameButton.textContent = "Start game!"
-        startGameButton.removeAttribute("disabled")
-        restartGameButton.removeAttribute("disabled")
-    }
+    renderGameSettings()
+    gameSettingsSection.classList.toggle("hidden", gameStatus === IN_PROGRESS)
+
+    updateSpectating()
+    updateHostControls()
 
     // register all listeners on the player's own client card
     registerClientCardEventListeners()
 
     // on first visit to this lobby, pre-select the name change input for convenience
-    if (localStorage.getItem("reconnectToken") !== reconnectToken) {
+    // (the reconnect token changes on every reconnect, so it can't tell us whether we've been here before)
+    const seat = `${lobbyId}:${myClientId}`
+    if (localStorage.getItem("seat") !== seat) {
         myDisplayNameInput.select()
     }
+    localStorage.setItem("seat", seat)
 
     // then save our reconnect token in case of severed connection or browser refresh
     localStorage.setItem("reconnectToken", reconnectToken)
 
+    // then start syncing our clock with the server (if we haven't already), so countdowns are accurate
+    if (!timeSyncInterval) {
+        syncTime()
+        timeSyncInterval = setInterval(syncTime, TIME_SYNC_INTERVAL)
+    }
+
     // then render the other buttons, etc. depending on the game state
     switch (gameStatus) {
         case WAITING_FOR_PLAYERS:
@@ -191,9 +371,13 @@ function onClientDetails(content) {
             }
             break
         case OVER:
-            statusText.textContent = `🎉 ${winnersName} has won! 🎉`
+            if (gameSettings["Mode"] === DAILY) {
+                statusText.textContent = "The daily challenge is over"
+            } else {
+                statusText.textContent = `🎉 ${winnersName} has won! 🎉`
+                restartGameButton.classList.remove("hidden")
+            }
             statusText.classList.remove("hidden")
-            restartGameButton.classList.remove("hidden")
             inviteButton.classList.remove("hidden")
             break
     }
@@ -209,7 +393,7 @@ function registerClientCardEventListeners() {
     // on change, broadcast new name to the other clients
     myDisplayNameInput.addEventListener("input", () => {
         let newDisplayName = myDisplayNameInput.value
-        ws.send(JSON.stringify({ Type: NAME_CHANGE, Content: newDisplayName }))
+        send({ Type: NAME_CHANGE, Content: newDisplayName })
     })
 
     // on focus, preselect the text for convenience
@@ -228,7 +412,7 @@ function registerClientCardEventListeners() {
     myDisplayNameInput.addEventListener("blur", () => {
         if (!myDisplayNameInput.value) {
             myDisplayNameInput.value = `Player ${myClientId}`
-            ws.send(JSON.stringify({ Type: NAME_CHANGE, Content: myDisplayNameInput.value }))
+            send({ Type: NAME_CHANGE, Content: myDisplayNameInput.value })
         }
     })
 }
@@ -238,26 +422,118 @@ function onClientJoined(content) {
     let displayName = content["DisplayName"]
     let iconName    = content["IconName"]
     let isAlive     = content["Alive"]
+    let isSpectator = content["Spectator"]
 
-    renderNewClientCard(newClientId, displayName, iconName, isAlive, false)
+    renderNewClientCard(newClientId, displayName, iconName, isAlive, isSpectator, false)
+    renderScore(newClientId, 0)
+    updateSpectating()
 
     clientJoinedAudio.volume = VOLUME
     clientJoinedAudio.play()
 
-    if (document.getElementById("clients-list").children.length >= 2) {
-        startGameButton.textContent = "Start game!"
-        startGameButton.removeAttribute("disabled")
-        restartGameButton.removeAttribute("disabled")
-    }
+    updateHostControls()
 }
 
 function onClientLeft(leavingClientId) {
     document.querySelector(`#clients-list [data-client-id="${leavingClientId}"]`).remove()
-    if (document.getElementById("clients-list").children.length < 2) {
+    updateSpectating()
+    updateHostControls()
+}
+
+function onHostChanged(newHostId) {
+    hostId = newHostId
+    updateHostControls()
+}
+
+function onSpectateChange(content) {
+    let clientId = content["ClientId"]
+    let spectator = content["Spectator"]
+
+    let card = document.querySelector(`#clients-list [data-client-id="${clientId}"]`)
+    card.toggleAttribute("data-spectator", spectator)
+    card.querySelector("[data-spectator-label]").classList.toggle("hidden", !spectator)
+    if (spectator) {
+        card.classList.add("opacity-40")
+    } else if (gameStatus !== IN_PROGRESS) {
+        card.classList.remove("opacity-40") // they'll play in the next game
+    }
+
+    if (clientId === myClientId) {
+        amSpectating = spectator
+    }
+
+    updateSpectating()
+    updateHostControls()
+}
+
+function onChangeSettings(settings) {
+    gameSettings = settings
+    renderGameSettings()
+}
+
+function renderGameSettings() {
+    const scoring = gameSettings["Mode"] === SCORING
+    const daily = gameSettings["Mode"] === DAILY
+    modeSelect.value = gameSettings["Mode"]
+    modeSelect.classList.toggle("hidden", daily)
+    seedInput.classList.toggle("hidden", daily)
+    roundsSelect.value = String(gameSettings["Rounds"])
+    targetScoreSelect.value = String(gameSettings["TargetScore"])
+    seedInput.value = gameSettings["Seed"] ? String(gameSettings["Seed"]) : ""
+    roundsSelect.classList.toggle("hidden", !scoring)
+    targetScoreSelect.classList.toggle("hidden", !scoring)
+    clientsList.querySelectorAll("[data-score]").forEach(score => score.classList.toggle("hidden", !scoring))
+}
+
+function onPointsAwarded(content) {
+    renderScore(content["ClientId"], content["Score"])
+}
+
+function renderScore(clientId, score) {
+    let scoreText = document.querySelector(`#clients-list [data-client-id="${clientId}"] [data-score]`)
+    scoreText.textContent = `${score} pts`
+    scoreText.classList.toggle("hidden", gameSettings["Mode"] !== SCORING)
+}
+
+// shows how many clients are spectating, and whether we are
+function updateSpectating() {
+    let spectators = clientsList.querySelectorAll("[data-spectator]").length
+    spectatorCount.textContent = `${spectators} spectating`
+    spectatorCount.classList.toggle("hidden", spectators === 0)
+    spectateButton.textContent = amSpectating ? "Play" : "Spectate"
+}
+
+// only the host can start or restart the game (once there are enough players), and kick or ban the other players
+function updateHostControls() {
+    const isHost = hostId === myClientId
+    const minPlayers = gameSettings["Mode"] === DAILY ? 1 : 2
+    const enoughPlayers = clientsList.querySelectorAll("[data-client-id]:not([data-spectator])").length >= minPlayers
+
+    for (const select of [modeSelect, roundsSelect, targetScoreSelect, seedInput]) {
+        select.disabled = !isHost
+    }
+
+    if (!enoughPlayers) {
         startGameButton.textContent = "Waiting for players..."
+    } else if (!isHost) {
+        startGameButton.textContent = "Waiting for the host..."
+    } else {
+        startGameButton.textContent = "Start game!"
+    }
+
+    if (isHost && enoughPlayers) {
+        startGameButton.removeAttribute("disabled")
+        restartGameButton.removeAttribute("disabled")
+    } else {
         startGameButton.setAttribute("disabled", "")
         restartGameButton.setAttribute("disabled", "")
     }
+
+    clientsList.querySelectorAll("[data-client-id]").forEach(card => {
+        const clientId = Number(card.dataset.clientId)
+        card.querySelector("[data-host-badge]").classList.toggle("hidden", clientId !== hostId)
+        card.querySelector("[data-host-controls]")?.classList.toggle("hidden", !isHost)
+    })
 }
 
 function onNameChange(content) {
@@ -270,23 +546,32 @@ function onNameChange(content) {
     }
 }
 
-function renderNewClientCard(clientId, displayName, iconName, alive, isMe) {
+function renderNewClientCard(clientId, displayName, iconName, alive, spectator, isMe) {
     let clientsList = document.getElementById("clients-list")
     let template = document.createElement("template")
     template.innerHTML = `
-        <div data-client-id="${clientId}" class="card card-compact bg-base-100 min-w-52 shadow-xl pt-2 ${!alive ? "opacity-40" : ""}" style="background-color: oklch(var(--n))">
+        <div data-client-id="${clientId}" ${spectator ? "data-spectator" : ""} class="card card-compact bg-base-100 min-w-52 shadow-xl pt-2 ${!alive ? "opacity-40" : ""}" style="background-color: oklch(var(--n))">
             <img
                 class="mask max-w-36 mx-auto"
                 src="/static/icons/${iconName}"
                 alt="${iconName}" />
             <div class="card-body items-center">
+                <span data-host-badge class="rounded-full bg-secondary px-3 font-bold hidden" style="color: oklch(var(--sc))">Host</span>
                 ${isMe
                     ? `<input id="my-display-name" class="input card-title text-center w-44" style="background-color: oklch(var(--n))" value="${displayName}">`
                     : `<p data-display-name class="card-title">${displayName}</p>`
                 }
+                <p data-spectator-label class="italic ${spectator ? "" : "hidden"}">Spectating</p>
+                <p data-score class="font-bold hidden"></p>
                 <div data-current-guess-pill class="rounded-full min-w-24 h-8 leading-8 bg-secondary text-center invisible">
                     <p data-current-guess class="font-bold px-3" style="color: oklch(var(--sc))"></p>
                 </div>
+                ${isMe ? "" : `
+                    <div data-host-controls class="flex flex-row gap-2 hidden">
+                        <button data-kick class="btn btn-outline">Kick</button>
+                        <button data-ban class="btn btn-outline btn-error">Ban</button>
+                    </div>
+                `}
             </div>
         </div>
     `
@@ -299,6 +584,7 @@ function onClientsTurn(content) {
 
     startGameButton.classList.add("hidden")
     inviteButton.classList.add("hidden")
+    gameSettingsSection.classList.add("hidden")
 
     let newClientsTurnId = content["ClientId"]
     let turnEnd = content["TurnEnd"] // milliseconds from unix epoch (UTC)
@@ -319,6 +605,7 @@ function onClientsTurn(content) {
 
     if (myClientId === newClientsTurnId) {
         // it's our turn
+        suggestionsTable.classList.add("hidden") // in scoring mode, we may still be showing suggestions from a turn we ran out of time on
         answerInput.value = ""
         challengeInputSection.classList.remove("hidden")
         answerInput.focus()
@@ -332,8 +619,45 @@ function onClientsTurn(content) {
     clientsTurnId = newClientsTurnId
 }
 
+// sends a round of time sync requests to the server, each response is handled by onTimeSync
+function syncTime() {
+    for (let i = 0; i < TIME_SYNC_SAMPLES; i++) {
+        setTimeout(() => send({ Type: TIME_SYNC_REQ, Content: {
+            ClientSend: Date.now(),
+            LastServerSend: lastTimeSync.serverSend ?? 0,
+            LastClientReceive: lastTimeSync.clientReceive ?? 0,
+        }}), i * TIME_SYNC_SPACING)
+    }
+}
+
+// records one NTP-style sample of the server's clock
+function onTimeSync(content) {
+    const clientReceive = Date.now()
+    const clientSend = content["ClientSend"]
+    const serverReceive = content["ServerReceive"]
+    const serverSend = content["ServerSend"]
+
+    timeSyncSamples.push({
+        offset: ((serverReceive - clientSend) + (serverSend - clientReceive)) / 2,
+        rtt: (clientReceive - clientSend) - (serverSend - serverReceive),
+    })
+    timeSyncSamples = timeSyncSamples.slice(-TIME_SYNC_MAX_KEPT)
+    lastTimeSync = { serverSend, clientReceive }
+}
+
+// returns how many milliseconds our clock is ahead of the server's, using the sample with the lowest round trip time
+// (it is the least affected by network delay), or falls back to a single server timestamp if we have no samples yet
+function getClockOffset(serverNow) {
+    if (timeSyncSamples.length === 0) {
+        return Date.now() - serverNow
+    }
+
+    const bestSample = timeSyncSamples.reduce((best, sample) => sample.rtt < best.rtt ? sample : best)
+    return -bestSample.offset
+}
+
 function countDownTurn(currentChallenge, turnEnd, serverNow) {
-    const offset = Date.now() - serverNow
+    const offset = getClockOffset(serverNow)
     console.log(`client is ${Math.abs(offset)}ms ${offset > 0 ? "ahead of" : "behind"} the server`)
     statusText.innerHTML = `
         <span class="md:mr-16">Challenge: ${currentChallenge}</span><br class="md:hidden">
@@ -384,7 +708,9 @@ function onAnswerRejected() {
 function onTurnExpired(content) {
     let eliminatedClientId = content["EliminatedClientId"]
     let suggestions = content["Suggestions"]
-    document.querySelector(`#clients-list [data-client-id="${eliminatedClientId}"]`).classList.add("opacity-40")
+    if (content["Eliminated"]) {
+        document.querySelector(`#clients-list [data-client-id="${eliminatedClientId}"]`).classList.add("opacity-40")
+    }
     clientEliminated.volume = VOLUME
     clientEliminated.play()
     if (eliminatedClientId === myClientId) {
@@ -405,7 +731,8 @@ function clearSuggestions() {
     suggestionsBody.innerHTML = ''
 }
 
-function onGameOver(winningClientId) {
+function onGameOver(content) {
+    let winningClientId = content["WinnerId"]
     clearInterval(turnCountdownInterval)
     gameStatus = OVER
 
@@ -419,37 +746,120 @@ function onGameOver(winningClientId) {
         currentGuessPill.classList.add("invisible")
     }
 
-    let winnersName
-    if (winningClientId === myClientId) {
-        // we won!
-        winnersName = document.getElementById("my-display-name").value
+    challengeInputSection.classList.add("hidden")
+
+    if (content["Mode"] === DAILY) {
+        // there's nobody to beat in a daily challenge, and only one attempt at it
+        const cleared = content["GameStats"][0]?.["Answers"] ?? 0
+        statusText.textContent = `🎉 ${cleared} challenges cleared! 🎉`
     } else {
-        winnersName = document.querySelector(`#clients-list [data-client-id="${winningClientId}"] [data-display-name]`).textContent
+        let winnersName
+        if (winningClientId === myClientId) {
+            // we won!
+            winnersName = document.getElementById("my-display-name").value
+        } else {
+            winnersName = document.querySelector(`#clients-list [data-client-id="${winningClientId}"] [data-display-name]`).textContent
+        }
+        statusText.textContent = `🎉 ${winnersName} has won! 🎉`
+        restartGameButton.classList.remove("hidden")
     }
-    statusText.textContent = `🎉 ${winnersName} has won! 🎉`
-
-    challengeInputSection.classList.add("hidden")
-    restartGameButton.classList.remove("hidden")
     inviteButtonText.textContent = "Copy invite link"
     inviteButton.classList.remove("hidden")
+
+    gameSettingsSection.classList.remove("hidden")
+    renderStats(content["Mode"], content["GameStats"], content["Tally"])
+
+    if (content["ReplayId"]) {
+        replayLink.href = "/api/replays/" + content["ReplayId"]
+        replayLink.classList.remove("hidden")
+    }
+}
+
+// shows how each player did in the game that just finished, along with how many games they've won in this lobby
+function renderStats(mode, gameStats, tally) {
+    let wins = new Map(tally.map(stats => [stats["ClientId"], `${stats["Wins"]}/${stats["GamesPlayed"]}`]))
+
+    statsBody.replaceChildren()
+    gameStats.forEach(stats => {
+        let row = document.createElement("tr")
+        row.innerHTML = `
+            <td></td>
+            <td>${stats["Answers"]} (${stats["Rejections"]} rejected)</td>
+            <td>${stats["Answers"] ? `${(stats["AverageResponseMs"] / 1000).toFixed(1)}s` : "-"}</td>
+            <td>${stats["LongestWord"] || "-"}</td>
+            <td>${mode === SCORING ? stats["Score"] : "-"}</td>
+            <td>${wins.get(stats["ClientId"]) ?? "-"}</td>
+        `
+        row.firstElementChild.textContent = stats["DisplayName"] // display names are chosen by players, so never render them as html
+        statsBody.appendChild(row)
+    })
+
+    statsTable.classList.remove("hidden")
 }
 
 function onRestartGame() {
     gameStatus = IN_PROGRESS
     restartGameButton.classList.add("hidden")
-    document.querySelectorAll("#clients-list [data-client-id]").forEach(renderedClient => {
+    document.querySelectorAll("#clients-list [data-client-id]:not([data-spectator])").forEach(renderedClient => {
         renderedClient.classList.remove("opacity-40")
     })
     suggestionsTable.classList.add("hidden")
+    statsTable.classList.add("hidden")
+    replayLink.classList.add("hidden")
+    clientsList.querySelectorAll("[data-client-id]").forEach(card => renderScore(Number(card.dataset.clientId), 0))
 }
 
-function onShutdown() {
+function onShutdown(content) {
+    if (content && content["Resumable"]) {
+        // the lobby has been saved, so wait for the server to come back and then rejoin it
+        toast("Server is being restarted now for upgrades. You'll be reconnected shortly...", "alert-warning")
+        expectingClose = true
+        setTimeout(rejoinAfterRestart, 4_000)
+        return
+    }
+
     toast("Server is being restarted now for upgrades. Leaving lobby...", "alert-warning")
     setTimeout(() => {
         location.href = "/"
     }, 4_000)
 }
 
+function onIdleWarning(content) {
+    const secondsLeft = Math.round((content["ClosesAt"] - content["Now"]) / 1_000)
+    toast(`This lobby will close in ${secondsLeft} seconds due to inactivity`, "alert-warning")
+}
+
+function onLobbyClosed(reason) {
+    expectingClose = true
+    toast(`${reason}. Leaving lobby...`, "alert-warning")
+    setTimeout(() => {
+        location.href = "/"
+    }, 4_000)
+}
+
+function onError(content) {
+    if (content["Code"] === "rate_limit_exceeded") {
+        onLobbyClosed(content["Message"])
+        return
+    }
+
+    toast(content["Message"], "alert-error")
+}
+
+// polls until the server is back up with our lobby restored, then reloads the page to reconnect
+async function rejoinAfterRestart() {
+    try {
+        const response = await fetch(`/api/lobby/${lobbyId}`)
+        if (response.ok) {
+            location.reload()
+            return
+        }
+    } catch {
+        // the server isn't back up yet
+    }
+    setTimeout(rejoinAfterRestart, 2_000)
+}
+
 function shakeElement(e, amt) {
     gsap.to(e, {
         x: -amt,
@@ -0,0 +1,177 @@
+// a minimal MessagePack encoder and decoder, covering what lobby messages are made of: nil, booleans, numbers, strings,
+// binary, arrays and maps. Integers beyond 32 bits are read as numbers, which is exact up to Number.MAX_SAFE_INTEGER
+const msgpack = (() => {
+    const textEncoder = new TextEncoder()
+    const textDecoder = new TextDecoder()
+
+    function encode(value) {
+        const bytes = []
+        encodeValue(value, bytes)
+        return new Uint8Array(bytes)
+    }
+
+    function encodeValue(value, bytes) {
+        if (value === null || value === undefined) {
+            bytes.push(0xc0)
+        } else if (typeof value === "boolean") {
+            bytes.push(value ? 0xc3 : 0xc2)
+        } else if (typeof value === "number") {
+            encodeNumber(value, bytes)
+        } else if (typeof value === "string") {
+            const data = textEncoder.encode(value)
+            pushLength(data.length, bytes, 0xa0, 31, 0xd9, 0xda, 0xdb)
+            bytes.push(...data)
+        } else if (value instanceof Uint8Array) {
+            pushLength(value.length, bytes, null, 0, 0xc4, 0xc5, 0xc6)
+            bytes.push(...value)
+        } else if (Array.isArray(value)) {
+            pushLength(value.length, bytes, 0x90, 15, null, 0xdc, 0xdd)
+            value.forEach(item => encodeValue(item, bytes))
+        } else if (typeof value === "object") {
+            const entries = Object.entries(value).filter(([, item]) => item !== undefined)
+            pushLength(entries.length, bytes, 0x80, 15, null, 0xde, 0xdf)
+            entries.forEach(([key, item]) => {
+                encodeValue(key, bytes)
+                encodeValue(item, bytes)
+            })
+        } else {
+            throw new Error(`msgpack can't encode ${typeof value}`)
+        }
+    }
+
+    function encodeNumber(value, bytes) {
+        if (!Number.isSafeInteger(value)) {
+            bytes.push(0xcb, ...toBytes(8, view => view.setFloat64(0, value)))
+        } else if (value >= 0 && value <= 0x7f) {
+            bytes.push(value)
+        } else if (value < 0 && value >= -32) {
+            bytes.push(value & 0xff)
+        } else if (value >= 0) {
+            if (value <= 0xff) {
+                bytes.push(0xcc, value)
+            } else if (value <= 0xffff) {
+                bytes.push(0xcd, ...toBytes(2, view => view.setUint16(0, value)))
+            } else if (value <= 0xffffffff) {
+                bytes.push(0xce, ...toBytes(4, view => view.setUint32(0, value)))
+            } else {
+                bytes.push(0xcf, ...toBytes(8, view => view.setBigUint64(0, BigInt(value))))
+            }
+        } else if (value >= -0x80) {
+            bytes.push(0xd0, value & 0xff)
+        } else if (value >= -0x8000) {
+            bytes.push(0xd1, ...toBytes(2, view => view.setInt16(0, value)))
+        } else if (value >= -0x80000000) {
+            bytes.push(0xd2, ...toBytes(4, view => view.setInt32(0, value)))
+        } else {
+            bytes.push(0xd3, ...toBytes(8, view => view.setBigInt64(0, BigInt(value))))
+        }
+    }
+
+    // pushes the header for a value of the given length, using the fix format (prefix | length) when it fits, then the
+    // 8, 16 or 32 bit formats (a null format means there isn't one of that size)
+    function pushLength(length, bytes, fixPrefix, fixMax, format8, format16, format32) {
+        if (fixPrefix !== null && length <= fixMax) {
+            bytes.push(fixPrefix | length)
+        } else if (format8 !== null && length <= 0xff) {
+            bytes.push(format8, length)
+        } else if (length <= 0xffff) {
+            bytes.push(format16, ...toBytes(2, view => view.setUint16(0, length)))
+        } else {
+            bytes.push(format32, ...toBytes(4, view => view.setUint32(0, length)))
+        }
+    }
+
+    function toBytes(size, write) {
+        const view = new DataView(new ArrayBuffer(size))
+        write(view)
+        return new Uint8Array(view.buffer)
+    }
+
+    function decode(data) {
+        const bytes = data instanceof Uint8Array ? data : new Uint8Array(data)
+        const view = new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength)
+        let offset = 0
+
+        function take(size) {
+            const start = offset
+            offset += size
+            if (offset > bytes.length) {
+                throw new Error("msgpack data ended unexpectedly")
+            }
+            return start
+        }
+
+        function readString(length) {
+            const start = take(length)
+            return textDecoder.decode(bytes.subarray(start, start + length))
+        }
+
+        function readBinary(length) {
+            const start = take(length)
+            return bytes.slice(start, start + length)
+        }
+
+        function readArray(length) {
+            const array = []
+            for (let i = 0; i < length; i++) {
+                array.push(readValue())
+            }
+            return array
+        }
+
+        function readMap(length) {
+            const map = {}
+            for (let i = 0; i < length; i++) {
+                const key = readValue()
+                map[key] = readValue()
+            }
+            return map
+        }
+
+        function readValue() {
+            const format = bytes[take(1)]
+            if (format <= 0x7f) {
+                return format
+            } else if (format <= 0x8f) {
+                return readMap(format & 0x0f)
+            } else if (format <= 0x9f) {
+                return readArray(format & 0x0f)
+            } else if (format <= 0xbf) {
+                return readString(format & 0x1f)
+            } else if (format >= 0xe0) {
+                return format - 0x100
+            }
+
+            switch (format) {
+                case 0xc0: return null
+                case 0xc2: return false
+                case 0xc3: return true
+                case 0xc4: return readBinary(view.getUint8(take(1)))
+                case 0xc5: return readBinary(view.getUint16(take(2)))
+                case 0xc6: return readBinary(view.getUint32(take(4)))
+                case 0xca: return view.getFloat32(take(4))
+                case 0xcb: return view.getFloat64(take(8))
+                case 0xcc: return view.getUint8(take(1))
+                case 0xcd: return view.getUint16(take(2))
+                case 0xce: return view.getUint32(take(4))
+                case 0xcf: return Number(view.getBigUint64(take(8)))
+                case 0xd0: return view.getInt8(take(1))
+                case 0xd1: return view.getInt16(take(2))
+                case 0xd2: return view.getInt32(take(4))
+                case 0xd3: return Number(view.getBigInt64(take(8)))
+                case 0xd9: return readString(view.getUint8(take(1)))
+                case 0xda: return readString(view.getUint16(take(2)))
+                case 0xdb: return readString(view.getUint32(take(4)))
+                case 0xdc: return readArray(view.getUint16(take(2)))
+                case 0xdd: return readArray(view.getUint32(take(4)))
+                case 0xde: return readMap(view.getUint16(take(2)))
+                case 0xdf: return readMap(view.getUint32(take(4)))
+                default: throw new Error(`msgpack format 0x${format.toString(16)} isn't supported`)
+            }
+        }
+
+        return readValue()
+    }
+
+    return { encode, decode }
+})()
@@ -6,6 +6,7 @@ import (
 	"math/rand/v2"
 	"os"
 	"path"
+	"slices"
 	"strings"
 )
 
@@ -52,7 +53,8 @@ func IsValidWord(word string) bool {
 	return words[word]
 }
 
-func GetChallenge(difficulty ChallengeDifficulty) string {
+// GetChallenge picks a challenge of the given difficulty using rng, so the same sequence of challenges can be produced again from the same seed
+func GetChallenge(rng *rand.Rand, difficulty ChallengeDifficulty) string {
 	third := len(challenges) / 3
 	var low, high int // each difficulty bracket sets these, and the resulting challenge is in the range [low, high)
 	switch difficulty {
@@ -70,13 +72,18 @@ func GetChallenge(difficulty ChallengeDifficulty) string {
 		high = len(challenges)
 	}
 
-	return challenges[rand.IntN(high-low)+low]
+	return challenges[rng.IntN(high-low)+low]
 }
 
 func GetChallengeSuggestions(challenge string) []string {
 	return suggestions[challenge]
 }
 
+// IsCommonAnswer reports whether word is one of the common answers suggested for the challenge
+func IsCommonAnswer(challenge string, word string) bool {
+	return slices.Contains(suggestions[challenge], word)
+}
+
 func processFile(fileName string, lineFn func(string)) error {
 	file, err := os.Open(path.Join(directory, fileName))
 	if err != nil {